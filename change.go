@@ -0,0 +1,116 @@
+package structconf
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// PathSeparator separates the keys of a dotted key path, like "logging.path"
+const PathSeparator = "."
+
+// ChangeFunc defines the function type of change subscribers.
+// old and new hold the value at the subscribed key path before and after the change.
+// A nil value indicates that the key did not exist before or does not exist anymore.
+type ChangeFunc func(old, new interface{})
+
+// subscription represents a ChangeFunc subscribed to a key path
+type subscription struct {
+	path []string
+	fn   ChangeFunc
+}
+
+// OnChange subscribes fn to changes of the value at the given dotted key path.
+//
+// The key path consists of the configuration's tag names, joined by ".". Keys of map values
+// may be used as path elements as well, which allows observing added and removed map keys.
+// An empty path subscribes to changes of the whole configuration.
+//
+// fn is called after the configuration has been applied by Load or SetDefaults, but only if
+// the value at the key path actually differs. As fn is called while the configuration is
+// being applied, it must not call Load or SetDefaults itself.
+func (c *Configuration) OnChange(path string, fn ChangeFunc) {
+	c.subscriptionsMutex.Lock()
+	defer c.subscriptionsMutex.Unlock()
+
+	c.subscriptions = append(c.subscriptions, subscription{
+		path: SplitPath(path),
+		fn:   fn,
+	})
+}
+
+// notifyChanges calls all subscribers whose value differs between oldMap and newMap
+func (c *Configuration) notifyChanges(oldMap, newMap map[string]interface{}) {
+	c.subscriptionsMutex.Lock()
+	subscriptions := make([]subscription, len(c.subscriptions))
+	copy(subscriptions, c.subscriptions)
+	c.subscriptionsMutex.Unlock()
+
+	for _, sub := range subscriptions {
+		oldValue := LookupPath(oldMap, sub.path)
+		newValue := LookupPath(newMap, sub.path)
+
+		if !reflect.DeepEqual(oldValue, newValue) {
+			sub.fn(oldValue, newValue)
+		}
+	}
+}
+
+// SplitPath splits a dotted key path into its elements.
+// An empty path results in an empty slice.
+func SplitPath(path string) []string {
+	if path == "" {
+		return []string{}
+	}
+	return strings.Split(path, PathSeparator)
+}
+
+// LookupPath returns the value stored at the given path inside a map representation
+// of a configuration.
+//
+// Map keys which are not strings are matched by their formatted value.
+// If the path does not exist, nil is returned.
+func LookupPath(m map[string]interface{}, path []string) interface{} {
+	var current interface{} = m
+
+	for _, key := range path {
+		currentValue := reflect.ValueOf(current)
+		if currentValue.Kind() != reflect.Map {
+			// Cannot descend any further
+			return nil
+		}
+
+		current = nil
+		for _, k := range currentValue.MapKeys() {
+			if fmt.Sprint(k.Interface()) == key {
+				current = currentValue.MapIndex(k).Interface()
+				break
+			}
+		}
+
+		if current == nil {
+			return nil
+		}
+	}
+
+	return current
+}
+
+// SetPath sets the value at the given path inside a map representation of a configuration,
+// creating intermediate maps as required. Values in the way of the path are replaced.
+// An empty path leaves the map unchanged.
+func SetPath(m map[string]interface{}, path []string, value interface{}) {
+	if len(path) == 0 {
+		return
+	}
+
+	for _, key := range path[:len(path)-1] {
+		child, ok := m[key].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			m[key] = child
+		}
+		m = child
+	}
+	m[path[len(path)-1]] = value
+}
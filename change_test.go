@@ -0,0 +1,161 @@
+package structconf
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anexia-it/go-structconf/encoding/json"
+	"github.com/anexia-it/go-structconf/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+type TestConfigLogging struct {
+	Path  string `config:"path"`
+	Level string `config:"level"`
+}
+
+type TestConfigNested struct {
+	Name    string            `config:"name"`
+	Logging TestConfigLogging `config:"logging"`
+	Servers map[string]string `config:"servers"`
+}
+
+type testChange struct {
+	old interface{}
+	new interface{}
+}
+
+func TestSplitPath(t *testing.T) {
+	require.EqualValues(t, []string{}, SplitPath(""))
+	require.EqualValues(t, []string{"logging"}, SplitPath("logging"))
+	require.EqualValues(t, []string{"logging", "path"}, SplitPath("logging.path"))
+}
+
+func TestLookupPath(t *testing.T) {
+	m := map[string]interface{}{
+		"name": "test",
+		"logging": map[string]interface{}{
+			"path": "/var/log/test.log",
+		},
+		"ports": map[interface{}]interface{}{
+			80: "http",
+		},
+	}
+
+	require.EqualValues(t, m, LookupPath(m, []string{}))
+	require.EqualValues(t, "test", LookupPath(m, []string{"name"}))
+	require.EqualValues(t, "/var/log/test.log", LookupPath(m, []string{"logging", "path"}))
+	require.EqualValues(t, "http", LookupPath(m, []string{"ports", "80"}))
+	require.Nil(t, LookupPath(m, []string{"missing"}))
+	require.Nil(t, LookupPath(m, []string{"logging", "missing"}))
+	require.Nil(t, LookupPath(m, []string{"name", "missing"}))
+}
+
+func TestSetPath(t *testing.T) {
+	m := map[string]interface{}{
+		"name": "test",
+	}
+
+	SetPath(m, []string{"logging", "path"}, "/var/log/test.log")
+	SetPath(m, []string{"logging", "level"}, "info")
+	SetPath(m, []string{"name", "first"}, "replaced")
+	SetPath(m, []string{}, "ignored")
+
+	require.EqualValues(t, map[string]interface{}{
+		"name": map[string]interface{}{
+			"first": "replaced",
+		},
+		"logging": map[string]interface{}{
+			"path":  "/var/log/test.log",
+			"level": "info",
+		},
+	}, m)
+}
+
+func TestConfiguration_OnChange(t *testing.T) {
+	enc, err := json.NewJSONEncoding()
+	require.NoError(t, err)
+
+	s := memory.NewMemoryStorage(memory.OptionData([]byte(`{"name":"test",` +
+		`"logging":{"path":"/var/log/test.log","level":"info"},"servers":{"a":"a.example.com"}}`)))
+	conf := &TestConfigNested{}
+	c, err := NewConfiguration(conf, OptionEncoding(enc), OptionStorage(s))
+	require.NoError(t, err)
+	require.NotNil(t, c)
+	require.NoError(t, c.Load())
+
+	// Subscribers are called from the goroutine running Watch
+	var mutex sync.Mutex
+	changes := make(map[string][]testChange)
+	subscribe := func(path string) {
+		c.OnChange(path, func(old, new interface{}) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			changes[path] = append(changes[path], testChange{old: old, new: new})
+		})
+	}
+	subscribe("")
+	subscribe("name")
+	subscribe("logging")
+	subscribe("logging.path")
+	subscribe("logging.level")
+	subscribe("servers.a")
+	subscribe("servers.b")
+
+	// Only the logging path changes
+	s.Set([]byte(`{"name":"test",` +
+		`"logging":{"path":"/var/log/other.log","level":"info"},"servers":{"a":"a.example.com"}}`))
+	require.NoError(t, c.Load())
+
+	require.Len(t, changes[""], 1)
+	require.Len(t, changes["logging"], 1)
+	require.EqualValues(t, []testChange{{old: "/var/log/test.log", new: "/var/log/other.log"}}, changes["logging.path"])
+	require.Empty(t, changes["name"])
+	require.Empty(t, changes["logging.level"])
+	require.Empty(t, changes["servers.a"])
+	require.Empty(t, changes["servers.b"])
+
+	// Loading the same values again must not report any changes
+	changes = make(map[string][]testChange)
+	require.NoError(t, c.Load())
+	require.Empty(t, changes)
+
+	// Reloading a document which replaces the servers map removes key "a" and adds key "b".
+	// The document is set until the change is picked up, as Watch might not observe the storage yet.
+	ctx, cancel := context.WithCancel(context.Background())
+	watchResult := make(chan error)
+	go func() {
+		watchResult <- c.Watch(ctx)
+	}()
+	require.Eventually(t, func() bool {
+		s.Set([]byte(`{"name":"test",` +
+			`"logging":{"path":"/var/log/other.log","level":"info"},"servers":{"b":"b.example.com"}}`))
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(changes["servers.b"]) > 0
+	}, 5*time.Second, 50*time.Millisecond)
+	cancel()
+	require.EqualError(t, <-watchResult, context.Canceled.Error())
+
+	require.EqualValues(t, []testChange{{old: "a.example.com", new: nil}}, changes["servers.a"])
+	require.EqualValues(t, []testChange{{old: nil, new: "b.example.com"}}, changes["servers.b"])
+	require.Empty(t, changes["logging"])
+	require.EqualValues(t, map[string]string{"b": "b.example.com"}, conf.Servers)
+}
+
+func TestConfiguration_OnChange_SetDefaults(t *testing.T) {
+	conf := &TestConfigNested{}
+
+	c, err := NewConfiguration(conf)
+	require.NoError(t, err)
+
+	var nameChanges []testChange
+	c.OnChange("name", func(old, new interface{}) {
+		nameChanges = append(nameChanges, testChange{old: old, new: new})
+	})
+
+	require.NoError(t, c.SetDefaults(&TestConfigNested{Name: "default"}))
+	require.EqualValues(t, []testChange{{old: "", new: "default"}}, nameChanges)
+}
@@ -1,7 +1,10 @@
 package structconf
 
 import (
+	"context"
+	"errors"
 	"reflect"
+	"unicode"
 
 	"sync"
 
@@ -15,6 +18,7 @@ import (
 // Default configuration options
 var defaultOptions = []Option{
 	OptionTagName("config"),
+	OptionMergeStrategy(MergePresent),
 }
 
 // Configuration represents a configuration backed by a struct
@@ -27,17 +31,99 @@ type Configuration struct {
 
 	storage  storage.Storage
 	encoding encoding.Encoding
+	sources  []*source
 
-	mapper *structmapper.Mapper
+	mapper        *structmapper.Mapper
+	mergeStrategy MergeStrategy
+
+	// skipValidation disables validation while the defaults from OptionDefaults are applied
+	skipValidation bool
+
+	// commitHook is called with the decoded instance of the configuration type,
+	// every time a change has been applied to the config struct
+	commitHook func(scratch reflect.Value)
+
+	// mutex serializes loading and applying of configuration values
+	mutex sync.Mutex
+
+	watchErrorHandler func(error)
+
+	env       bool
+	envPrefix string
+
+	overlays []overlay
+
+	// base holds the map representation of the config struct before it was first loaded, along
+	// with the origins of its values. Reloads during Watch and overlays applied after the
+	// configuration has been loaded start from it, so removed values do not linger.
+	base       map[string]interface{}
+	baseOrigin originFunc
+
+	// loaded holds the maps read from the sources and environment variables by the last Load,
+	// along with the originFunc for each of the maps
+	loaded        []map[string]interface{}
+	loadedOrigins []originFunc
+
+	provenance      map[string]Origin
+	provenanceMutex sync.RWMutex
+
+	subscriptions      []subscription
+	subscriptionsMutex sync.Mutex
+
+	// versions holds the versions of the loaded configurations by source name
+	versions      map[string]storage.Version
+	versionsMutex sync.Mutex
 }
 
-func (c *Configuration) mergeAndSet(a, b map[string]interface{}) error {
-	// Merge both maps...
-	mergedMap, err := MergeMaps(a, b)
+func (c *Configuration) mergeAndSet(strategy MergeStrategy, maps ...map[string]interface{}) error {
+	// Merge all maps in order...
+	mergedMap := map[string]interface{}{}
+	for _, m := range maps {
+		var err error
+		if mergedMap, err = MergeMapsWithStrategy(mergedMap, m, strategy); err != nil {
+			return err
+		}
+	}
+
+	// nil values cannot be applied by the mapper and represent unset values anyway
+	removeNilValues(mergedMap)
+
+	// Decode the result onto a new instance first, so the config remains untouched if
+	// the map cannot be applied or the result turns out to be invalid
+	scratch := reflect.New(c.configType)
+	if err := c.mapper.ToStruct(mergedMap, scratch.Interface()); err != nil {
+		return err
+	}
+
+	if !c.skipValidation {
+		if err := c.validate(scratch); err != nil {
+			return err
+		}
+	}
+
+	// Fields missing from the merged map are reset, so removed values do not linger
+	fields, err := c.mapper.ToMap(reflect.New(c.configType).Interface())
+	if err != nil {
+		return err
+	}
+
+	oldMap, newMap, err := c.set(scratch, fields)
 	if err != nil {
 		return err
 	}
 
+	if c.commitHook != nil {
+		c.commitHook(scratch)
+	}
+
+	// Inform subscribers about what actually changed
+	c.notifyChanges(oldMap, newMap)
+	return nil
+}
+
+// set copies the fields present in the map m from the decoded instance scratch to the config struct
+// and returns the map representations of the config struct before and after the change
+func (c *Configuration) set(scratch reflect.Value, m map[string]interface{}) (oldMap, newMap map[string]interface{}, err error) {
 	// If the configuration implements the sync.Locker interface, use it.
 	// This allows configuration structs to ensure no race-conditions are created
 	// by a write during a read.
@@ -48,13 +134,60 @@ func (c *Configuration) mergeAndSet(a, b map[string]interface{}) error {
 		// when leaving this function, not the if block.
 		defer locker.Unlock()
 	}
-	// Apply the merged result to the config
-	err = c.mapper.ToStruct(mergedMap, c.config)
-	return err
+
+	if oldMap, err = c.mapper.ToMap(c.config); err != nil {
+		return
+	}
+
+	// Apply the decoded result to the config
+	c.copyFields(reflect.ValueOf(c.config).Elem(), scratch.Elem(), m)
+
+	newMap, err = c.mapper.ToMap(c.config)
+	return
+}
+
+// copyFields copies the values of all fields present in the map representation m from src to dst.
+//
+// Only fields handled by the mapper are copied, private fields, like the state of an embedded
+// sync.Mutex, are left untouched.
+func (c *Configuration) copyFields(dst, src reflect.Value, m map[string]interface{}) {
+	t := dst.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		fieldD := t.Field(i)
+
+		if fieldD.Anonymous && fieldD.Type.Kind() == reflect.Struct {
+			// Fields of anonymous structs are mapped as fields of the embedding struct
+			c.copyFields(dst.Field(i), src.Field(i), m)
+			continue
+		} else if fieldD.Anonymous {
+			if src.Field(i).CanSet() && !src.Field(i).IsZero() {
+				dst.Field(i).Set(src.Field(i))
+			}
+			continue
+		}
+
+		if !unicode.IsUpper([]rune(fieldD.Name)[0]) {
+			// Ignore private fields
+			continue
+		}
+
+		name := fieldName(fieldD, c.tagName)
+		if _, ok := m[name]; ok && name != "-" {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
 }
 
 // SetDefaults sets the defaults value for the configuration
+//
+// Non-zero values of the config struct take precedence over the defaults. If the configuration has
+// already been loaded, keys present in the loaded documents keep taking precedence, even if zero.
+// The resulting configuration is validated before it is applied, see Validator and ValidationTagName.
 func (c *Configuration) SetDefaults(defaults interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	// Defaults must be set to a non-nil value
 	if defaults == nil {
 		return ErrConfigStructIsNil
@@ -77,69 +210,293 @@ func (c *Configuration) SetDefaults(defaults interface{}) error {
 		return err
 	}
 
-	configMap, err := c.mapper.ToMap(c.config)
+	base, baseOrigin, err := c.currentBase()
 	if err != nil {
 		return err
 	}
 
-	return c.mergeAndSet(defaultsMap, configMap)
+	// Values already set on the config take precedence and keep their origin.
+	// As the config's map representation contains all fields, only non-zero values can be
+	// told apart from unset ones.
+	if base, baseOrigin, err = withDefaults(base, baseOrigin, defaultsMap); err != nil {
+		return err
+	}
+
+	// The loaded values and overlays are applied on top again, so keys present in a document keep
+	// taking precedence, even if zero
+	if err := c.rebuild(base, baseOrigin, c.loaded, c.loadedOrigins, c.overlays); err != nil {
+		return err
+	}
+
+	if c.base != nil {
+		c.base = base
+		c.baseOrigin = baseOrigin
+	}
+	return nil
 }
 
-// Load loads the configuration from the underlying storage
-func (c *Configuration) Load() error {
-	// Check if encoding and storage were configured
-	if c.encoding == nil {
-		return ErrEncodingNotConfigured
-	} else if c.storage == nil {
-		return ErrStorageNotConfigured
+// withDefaults merges the map representation of the defaults under the passed base map and returns
+// the result along with the origins of its values
+func withDefaults(base map[string]interface{}, baseOrigin originFunc, defaultsMap map[string]interface{}) (map[string]interface{}, originFunc, error) {
+	merged, err := MergeMapsWithStrategy(defaultsMap, base, MergeNonZero)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provenance := make(map[string]Origin)
+	collectProvenance(provenance, MergeNonZero, []map[string]interface{}{defaultsMap, base},
+		[]originFunc{staticOrigin(Origin{Source: OriginDefaults}), baseOrigin})
+	return merged, mapOrigin(provenance), nil
+}
+
+// currentBase returns the map representation and origins the configuration is rebuilt from, which is
+// the configuration as it was before it was first loaded, or the current configuration if it has not
+// been loaded yet
+func (c *Configuration) currentBase() (map[string]interface{}, originFunc, error) {
+	if c.base != nil {
+		return c.base, c.baseOrigin, nil
+	}
+
+	base, err := c.mapper.ToMap(c.config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return base, c.provenanceOrigin(), nil
+}
+
+// rebuild applies the passed base map, the passed maps read by Load and the values of the passed
+// overlays in this order, replacing the current configuration and its provenance.
+// loadedOrigins holds the originFunc for each of the loaded maps.
+func (c *Configuration) rebuild(base map[string]interface{}, baseOrigin originFunc, loaded []map[string]interface{}, loadedOrigins []originFunc, overlays []overlay) error {
+	maps := append([]map[string]interface{}{base}, loaded...)
+	origins := append([]originFunc{baseOrigin}, loadedOrigins...)
+	for i := range overlays {
+		o := &overlays[i]
+		maps = append(maps, o.values)
+		origins = append(origins, o.origin)
 	}
 
-	buf, err := c.storage.ReadConfig()
+	if err := c.mergeAndSet(c.mergeStrategy, maps...); err != nil {
+		return err
+	}
+
+	// The origins are collected from scratch, so the origins of removed values are forgotten
+	provenance := make(map[string]Origin)
+	collectProvenance(provenance, c.mergeStrategy, maps, origins)
+	c.setProvenance(provenance)
+	return nil
+}
+
+// Load loads the configuration from the underlying storage.
+//
+// The values of the storage are applied on top of the current configuration, see OptionMergeStrategy.
+// Reloads during Watch start from the configuration as it was before it was first loaded instead, so
+// values removed from a storage are reset.
+// If multiple sources are configured, the values of all sources are applied in order of their
+// priority, with values of higher priority sources taking precedence.
+// The documents of storages implementing storage.MultiDocument, like drop-in directories, are
+// applied in the order returned by the storage.
+// The resulting configuration is validated before it is applied, see Validator and ValidationTagName.
+func (c *Configuration) Load() error {
+	return c.load(false)
+}
+
+// load loads the configuration from the underlying storage on top of the current configuration or,
+// if reset is set, on top of the configuration as it was before it was first loaded
+func (c *Configuration) load(reset bool) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	layers, err := c.layers()
 	if err != nil {
-		// Storage reported error
 		return err
 	}
 
-	// Decode onto map[string]interface{}
-	loadedMap := make(map[string]interface{})
-	if err := c.encoding.UnmarshalTo(buf, loadedMap); err != nil {
-		// Encoding error
+	base, baseOrigin := c.base, c.baseOrigin
+	if !reset || base == nil {
+		if base, err = c.mapper.ToMap(c.config); err != nil {
+			return err
+		}
+		baseOrigin = c.provenanceOrigin()
+	}
+
+	var maps []map[string]interface{}
+	var origins []originFunc
+	versions := make(map[string]storage.Version)
+
+	for _, layer := range layers {
+		documents, version, err := layer.read()
+		if err != nil {
+			return sourceError(layer, err)
+		}
+		versions[layer.name] = version
+
+		// Optional sources which do not exist provide no documents
+		for _, doc := range documents {
+			maps = append(maps, doc.values)
+			origins = append(origins, staticOrigin(doc.origin))
+		}
+	}
+
+	if c.env {
+		// Environment variables override the values from the storage
+		envMap, envOrigin, err := c.envMap()
+		if err != nil {
+			return err
+		}
+		maps = append(maps, envMap)
+		origins = append(origins, envOrigin)
+	}
+
+	// Overlays always take precedence
+	if err := c.rebuild(base, baseOrigin, maps, origins, c.overlays); err != nil {
 		return err
 	}
 
-	// Create a map from the current configuration
-	currentMap, mapErr := c.mapper.ToMap(c.config)
-	if mapErr != nil {
-		return mapErr
+	if c.base == nil {
+		c.base = base
+		c.baseOrigin = baseOrigin
+	}
+	c.loaded = maps
+	c.loadedOrigins = origins
+	c.setVersions(versions)
+	return nil
+}
+
+// Map returns the map representation of the current configuration
+func (c *Configuration) Map() (map[string]interface{}, error) {
+	if locker, ok := c.config.(sync.Locker); ok {
+		locker.Lock()
+		defer locker.Unlock()
 	}
 
-	return c.mergeAndSet(currentMap, loadedMap)
+	return c.mapper.ToMap(c.config)
 }
 
-// Save writes the configuration to the underlying storage
-func (c *Configuration) Save() error {
-	// Check if encoding and storage were configured
-	if c.encoding == nil {
-		return ErrEncodingNotConfigured
-	} else if c.storage == nil {
-		return ErrStorageNotConfigured
+// Watch observes the underlying storages and reloads the configuration every time
+// a storage reports a change.
+//
+// Watch blocks until the passed context is done. Errors encountered while reloading
+// are passed to the handler configured using OptionWatchErrorHandler and leave the
+// currently loaded configuration in place. If all observed storages stop reporting changes
+// before the context is done, ErrWatchStopped is passed to the handler and returned.
+// Storages which do not implement the storage.Watcher interface or return
+// storage.ErrWatchNotSupported are not observed. If none of the storages can be observed,
+// storage.ErrWatchNotSupported is returned.
+func (c *Configuration) Watch(ctx context.Context) error {
+	layers, err := c.layers()
+	if err != nil {
+		return err
 	}
 
-	// Convert the configuration to a map
-	configData, err := c.mapper.ToMap(c.config)
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	changes := make(chan struct{}, 1)
+	var wg sync.WaitGroup
+	watched := 0
+
+	for _, layer := range layers {
+		watcher, ok := layer.storage.(storage.Watcher)
+		if !ok {
+			continue
+		}
+
+		layerChanges, err := watcher.Watch(watchCtx)
+		if errors.Is(err, storage.ErrWatchNotSupported) {
+			// Storages wrapping other storages report whether the wrapped storage supports watching
+			continue
+		} else if err != nil {
+			return sourceError(layer, err)
+		}
+		watched++
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range layerChanges {
+				// Coalesce changes of all storages
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+
+	if watched == 0 {
+		return storage.ErrWatchNotSupported
+	}
+
+	go func() {
+		wg.Wait()
+		close(changes)
+	}()
+
+	for range changes {
+		if err := c.load(true); err != nil && c.watchErrorHandler != nil {
+			c.watchErrorHandler(err)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// The configuration is not reloaded anymore, even though the caller expects it to be
+	if c.watchErrorHandler != nil {
+		c.watchErrorHandler(ErrWatchStopped)
+	}
+	return ErrWatchStopped
+}
+
+// Save writes the configuration to the underlying storage.
+//
+// If multiple sources are configured, the configuration is written to the writable source only.
+//
+// If the storage implements storage.Versioned, the configuration is only written if the stored
+// configuration has not been changed since it was loaded. Otherwise, ErrConflict is returned.
+// SaveForce disables this check.
+func (c *Configuration) Save(options ...SaveOption) error {
+	opts := saveOptions{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	layers, err := c.layers()
+	if err != nil {
+		return err
+	}
+
+	var target *source
+	for _, layer := range layers {
+		if layer.writable {
+			target = layer
+		}
+	}
+	if target == nil {
+		return ErrNoWritableSource
+	}
+
+	// Convert the configuration to a map, holding the config struct's lock if it has one
+	configData, err := c.Map()
 	if err != nil {
 		return err
 	}
 
 	// Encode the configuration using the encoding
-	encoded, err := c.encoding.MarshalFrom(configData)
+	encoded, err := target.encoding.MarshalFrom(configData)
 	if err != nil {
 		return err
 	}
 
 	// Write the configuration to the storage
-	if err := c.storage.WriteConfig(encoded); err != nil {
-		return err
+	if versioned, ok := target.storage.(storage.Versioned); ok {
+		return c.writeVersioned(target, versioned, encoded, opts.force)
+	}
+
+	if err := target.storage.WriteConfig(encoded); err != nil {
+		return sourceError(target, err)
 	}
 
 	return nil
@@ -194,7 +551,12 @@ func NewConfiguration(config interface{}, options ...Option) (*Configuration, er
 
 	if c.pendingDefaults != nil {
 		// OptionDefaults was used, apply defaults now...
-		if err := c.SetDefaults(c.pendingDefaults); err != nil {
+		// Defaults are not expected to form a complete configuration on their own,
+		// so validation is deferred until the configuration is loaded.
+		c.skipValidation = true
+		err := c.SetDefaults(c.pendingDefaults)
+		c.skipValidation = false
+		if err != nil {
 			return nil, err
 		}
 		// Clear pendingDefaults again
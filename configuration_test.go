@@ -1,8 +1,11 @@
 package structconf
 
 import (
+	"context"
 	"errors"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"sync"
 
@@ -12,10 +15,13 @@ import (
 	"strings"
 
 	"github.com/anexia-it/go-structconf/encoding/json"
+	"github.com/anexia-it/go-structconf/storage"
 	"github.com/anexia-it/go-structconf/storage/file"
+	"github.com/anexia-it/go-structconf/storage/memory"
 	"github.com/golang/mock/gomock"
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/go-multierror"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/anexia-it/go-structmapper.v1"
 )
@@ -202,6 +208,25 @@ func TestConfiguration_SetDefaults_WithLocker(t *testing.T) {
 
 }
 
+func TestConfiguration_Save_WithLocker(t *testing.T) {
+	enc, err := json.NewJSONEncoding()
+	require.NoError(t, err)
+
+	conf := &TestConfigWithLocker{}
+	conf.Test = "saved"
+	s := memory.NewMemoryStorage()
+	c, err := NewConfiguration(conf, OptionEncoding(enc), OptionStorage(s))
+	require.NoError(t, err)
+
+	// Saving reads the config struct while holding its lock, as Watch may reload it concurrently
+	require.NoError(t, c.Save())
+	require.EqualValues(t, 1, conf.lockCalled)
+	require.EqualValues(t, 1, conf.unlockCalled)
+
+	data, _ := s.Data()
+	require.JSONEq(t, `{"test":"saved"}`, string(data))
+}
+
 func TestConfiguration_Load_NoEncoding(t *testing.T) {
 	conf := &TestConfigSimple{}
 
@@ -318,3 +343,334 @@ func TestConfiguration_Save_Simple(t *testing.T) {
 	require.NoError(t, err)
 	require.EqualValues(t, jsonString, strings.TrimSuffix(string(writtenBytes), "\n"))
 }
+
+func TestConfiguration_Save_Memory(t *testing.T) {
+	enc, err := json.NewJSONEncoding()
+	require.NoError(t, err)
+
+	s := memory.NewMemoryStorage(memory.OptionData([]byte(`{"test":"seeded"}`)))
+	conf := &TestConfigSimple{}
+
+	c, err := NewConfiguration(conf, OptionEncoding(enc), OptionStorage(s))
+	require.NoError(t, err)
+	require.NoError(t, c.Load())
+	require.EqualValues(t, "seeded", conf.Test)
+
+	conf.Test = "saved"
+	require.NoError(t, c.Save())
+
+	data, ok := s.Data()
+	require.True(t, ok)
+	require.JSONEq(t, `{"test":"saved"}`, string(data))
+
+	// Failing reads leave the configuration untouched
+	testErr := errors.New("test error")
+	s.FailNextRead(testErr)
+	require.ErrorIs(t, c.Load(), testErr)
+	require.EqualValues(t, "saved", conf.Test)
+
+	require.EqualValues(t, 2, s.Reads())
+	require.EqualValues(t, 1, s.Writes())
+}
+
+type TestConfigWatch struct {
+	sync.Mutex
+	Test string `config:"test"`
+}
+
+func (c *TestConfigWatch) getTest() string {
+	c.Lock()
+	defer c.Unlock()
+	return c.Test
+}
+
+func TestConfiguration_Watch_NotSupported(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	enc, err := json.NewJSONEncoding()
+	require.NoError(t, err)
+
+	c, err := NewConfiguration(&TestConfigSimple{}, OptionEncoding(enc), OptionStorage(NewMockStorage(ctrl)))
+	require.NoError(t, err)
+	require.NotNil(t, c)
+
+	require.EqualError(t, c.Watch(context.Background()), storage.ErrWatchNotSupported.Error())
+}
+
+func TestConfiguration_Watch_NotConfigured(t *testing.T) {
+	c, err := NewConfiguration(&TestConfigSimple{})
+	require.NoError(t, err)
+	require.EqualError(t, c.Watch(context.Background()), ErrEncodingNotConfigured.Error())
+
+	enc, err := json.NewJSONEncoding()
+	require.NoError(t, err)
+	c, err = NewConfiguration(&TestConfigSimple{}, OptionEncoding(enc))
+	require.NoError(t, err)
+	require.EqualError(t, c.Watch(context.Background()), ErrStorageNotConfigured.Error())
+}
+
+func TestConfiguration_Watch(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "go-structconf-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	configPath := filepath.Join(tempDir, "config.json")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(`{"test":"initial"}`), 0640))
+
+	enc, err := json.NewJSONEncoding()
+	require.NoError(t, err)
+
+	reloadErrors := make(chan error, 10)
+	conf := &TestConfigWatch{}
+	c, err := NewConfiguration(conf,
+		OptionEncoding(enc),
+		OptionStorage(file.NewFileStorage(configPath, 0640)),
+		OptionWatchErrorHandler(func(err error) {
+			reloadErrors <- err
+		}))
+	require.NoError(t, err)
+	require.NoError(t, c.Load())
+	require.EqualValues(t, "initial", conf.getTest())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watchResult := make(chan error)
+	go func() {
+		watchResult <- c.Watch(ctx)
+	}()
+
+	// Wait for Watch to pick up the change
+	require.Eventually(t, func() bool {
+		// The file is rewritten until the change is picked up, as the watcher might
+		// not be set up on the first write
+		// The condition runs on another goroutine, where require must not be used
+		assert.NoError(t, ioutil.WriteFile(configPath, []byte(`{"test":"changed"}`), 0640))
+		return conf.getTest() == "changed"
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// Invalid contents must be reported and must not affect the loaded configuration
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(`{"test":`), 0640))
+	select {
+	case reloadErr := <-reloadErrors:
+		require.Error(t, reloadErr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reload error not reported")
+	}
+	require.EqualValues(t, "changed", conf.getTest())
+
+	cancel()
+	select {
+	case watchErr := <-watchResult:
+		require.EqualError(t, watchErr, context.Canceled.Error())
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch did not return after context was cancelled")
+	}
+}
+
+// stoppedWatcherStorage is a storage which stops reporting changes right away
+type stoppedWatcherStorage struct {
+	*memory.Storage
+}
+
+func (s stoppedWatcherStorage) Watch(context.Context) (<-chan struct{}, error) {
+	changes := make(chan struct{})
+	close(changes)
+	return changes, nil
+}
+
+func TestConfiguration_Watch_Stopped(t *testing.T) {
+	enc, err := json.NewJSONEncoding()
+	require.NoError(t, err)
+
+	var reloadErrors []error
+	c, err := NewConfiguration(&TestConfigSimple{},
+		OptionEncoding(enc),
+		OptionStorage(stoppedWatcherStorage{memory.NewMemoryStorage()}),
+		OptionWatchErrorHandler(func(err error) {
+			reloadErrors = append(reloadErrors, err)
+		}))
+	require.NoError(t, err)
+
+	require.ErrorIs(t, c.Watch(context.Background()), ErrWatchStopped)
+	require.EqualValues(t, []error{ErrWatchStopped}, reloadErrors)
+}
+
+func TestConfiguration_Watch_RemovedKeys(t *testing.T) {
+	enc, err := json.NewJSONEncoding()
+	require.NoError(t, err)
+
+	s := memory.NewMemoryStorage(memory.OptionData(
+		[]byte(`{"name":"x","logging":{"level":"debug"},"servers":{"a":"a","b":"b"}}`)))
+	conf := &TestConfigNested{}
+	c, err := NewConfiguration(conf,
+		OptionEncoding(enc),
+		OptionStorage(s),
+		OptionDefaults(&TestConfigNested{Logging: TestConfigLogging{Level: "info"}}))
+	require.NoError(t, err)
+	require.NoError(t, c.Load())
+	require.EqualValues(t, "x", conf.Name)
+	require.EqualValues(t, "debug", conf.Logging.Level)
+	require.EqualValues(t, map[string]string{"a": "a", "b": "b"}, conf.Servers)
+
+	reloaded := make(chan struct{}, 1)
+	c.OnChange("", func(old, new interface{}) {
+		reloaded <- struct{}{}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watchResult := make(chan error)
+	go func() {
+		watchResult <- c.Watch(ctx)
+	}()
+
+	// Keys removed from the document are reset to their default value.
+	// The document is set until the change is picked up, as Watch might not observe the storage yet.
+	require.Eventually(t, func() bool {
+		s.Set([]byte(`{"servers":{"a":"a"}}`))
+		select {
+		case <-reloaded:
+			return true
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, 50*time.Millisecond)
+
+	cancel()
+	require.EqualError(t, <-watchResult, context.Canceled.Error())
+
+	require.EqualValues(t, "", conf.Name)
+	require.EqualValues(t, "info", conf.Logging.Level)
+	require.EqualValues(t, map[string]string{"a": "a"}, conf.Servers)
+
+	origin, ok := c.Provenance("logging.level")
+	require.True(t, ok)
+	require.EqualValues(t, OriginDefaults, origin.Source)
+	// The origin of removed keys is forgotten
+	_, ok = c.Provenance("servers.b")
+	require.False(t, ok)
+
+	// Load applies the document on top of the current configuration
+	conf.Name = "set"
+	s.Set([]byte(`{"servers":{"b":"b"}}`))
+	require.NoError(t, c.Load())
+	require.EqualValues(t, "set", conf.Name)
+	require.EqualValues(t, map[string]string{"a": "a", "b": "b"}, conf.Servers)
+}
+
+type TestConfigZeroValues struct {
+	Enabled bool   `config:"enabled"`
+	Retries int    `config:"retries"`
+	Name    string `config:"name"`
+}
+
+func TestConfiguration_Load_ZeroValues(t *testing.T) {
+	defaults := &TestConfigZeroValues{
+		Enabled: true,
+		Retries: 3,
+		Name:    "default",
+	}
+
+	// Keys present in the document override the defaults, even if zero
+	conf := &TestConfigZeroValues{}
+	c := newEnvTestConfiguration(t, conf, `{"enabled":false,"retries":0}`, OptionDefaults(defaults))
+	require.NoError(t, c.Load())
+	require.EqualValues(t, &TestConfigZeroValues{
+		Enabled: false,
+		Retries: 0,
+		Name:    "default",
+	}, conf)
+
+	origin, ok := c.Provenance("enabled")
+	require.True(t, ok)
+	require.EqualValues(t, DefaultSourceName, origin.Source)
+
+	// Setting the defaults after loading keeps the values of the document
+	require.NoError(t, c.SetDefaults(defaults))
+	require.EqualValues(t, &TestConfigZeroValues{
+		Enabled: false,
+		Retries: 0,
+		Name:    "default",
+	}, conf)
+
+	origin, ok = c.Provenance("enabled")
+	require.True(t, ok)
+	require.EqualValues(t, DefaultSourceName, origin.Source)
+	origin, ok = c.Provenance("name")
+	require.True(t, ok)
+	require.EqualValues(t, OriginDefaults, origin.Source)
+
+	// MergeNonZero restores the previous behavior
+	conf = &TestConfigZeroValues{}
+	c = newEnvTestConfiguration(t, conf, `{"enabled":false,"retries":0}`, OptionDefaults(defaults),
+		OptionMergeStrategy(MergeNonZero))
+	require.NoError(t, c.Load())
+	require.EqualValues(t, defaults, conf)
+
+	origin, ok = c.Provenance("enabled")
+	require.True(t, ok)
+	require.EqualValues(t, OriginDefaults, origin.Source)
+}
+
+func TestConfiguration_Load_CurrentValues(t *testing.T) {
+	conf := &TestConfigZeroValues{}
+	c := newEnvTestConfiguration(t, conf, `{"name":"loaded"}`, OptionDefaults(&TestConfigZeroValues{Retries: 3}))
+
+	// Values set on the config struct after NewConfiguration are kept
+	conf.Retries = 7
+	require.NoError(t, c.Load())
+	require.EqualValues(t, &TestConfigZeroValues{Retries: 7, Name: "loaded"}, conf)
+}
+
+func TestConfiguration_Load_ZeroValuesEnv(t *testing.T) {
+	t.Setenv("APP_ENABLED", "false")
+
+	conf := &TestConfigZeroValues{}
+	c := newEnvTestConfiguration(t, conf, `{}`, OptionDefaults(&TestConfigZeroValues{Enabled: true}),
+		OptionEnvPrefix("APP"))
+	require.NoError(t, c.Load())
+	require.False(t, conf.Enabled)
+}
+
+type TestConfigTransactional struct {
+	TestConfigWithLocker
+
+	Port    int                 `config:"port"`
+	Servers map[string]string   `config:"servers"`
+	Backup  *TestConfigDatabase `config:"backup"`
+	Ignored string              `config:"-"`
+	private string
+}
+
+func TestConfiguration_Load_Transactional(t *testing.T) {
+	conf := &TestConfigTransactional{
+		Port: 80,
+		Servers: map[string]string{
+			"a": "a.example.com",
+		},
+		Ignored: "ignored",
+		private: "private",
+	}
+	conf.Test = "test"
+
+	c := newEnvTestConfiguration(t, conf, `{"test":"loaded","port":8080,"servers":{"b":"b.example.com"},"backup":"not a struct"}`)
+
+	// Decoding the document onto the config struct fails, which must leave it untouched
+	require.Error(t, c.Load())
+	require.Nil(t, conf.Backup)
+	require.EqualValues(t, "test", conf.Test)
+	require.EqualValues(t, 80, conf.Port)
+	require.EqualValues(t, map[string]string{"a": "a.example.com"}, conf.Servers)
+	// The config struct has not even been locked
+	require.EqualValues(t, 0, conf.lockCalled)
+
+	// Applying a valid document replaces mapped fields only
+	c = newEnvTestConfiguration(t, conf, `{"test":"loaded","port":8080,"servers":{"b":"b.example.com"}}`)
+	require.NoError(t, c.Load())
+	require.EqualValues(t, "loaded", conf.Test)
+	require.EqualValues(t, 8080, conf.Port)
+	require.EqualValues(t, map[string]string{"a": "a.example.com", "b": "b.example.com"}, conf.Servers)
+	require.EqualValues(t, "ignored", conf.Ignored)
+	require.EqualValues(t, "private", conf.private)
+	require.EqualValues(t, 1, conf.lockCalled)
+	require.EqualValues(t, 1, conf.unlockCalled)
+}
@@ -0,0 +1,65 @@
+package structconf
+
+import (
+	"os"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// EnvSeparator separates the elements of environment variable names
+const EnvSeparator = "_"
+
+// EnvName returns the name of the environment variable which overrides the given field
+//
+// The name consists of the prefix and the upper-cased path of the field, joined by "_".
+func EnvName(prefix string, field Field) string {
+	elements := make([]string, 0, len(field.Path)+1)
+	if prefix != "" {
+		elements = append(elements, prefix)
+	}
+	for _, element := range field.Path {
+		elements = append(elements, strings.ToUpper(element))
+	}
+	return strings.Join(elements, EnvSeparator)
+}
+
+// envMap builds a map representation of all fields overridden by environment variables,
+// along with an originFunc reporting the variable names
+func (c *Configuration) envMap() (map[string]interface{}, originFunc, error) {
+	m := make(map[string]interface{})
+	names := make(map[string]string)
+
+	var err error
+	for _, field := range c.Fields() {
+		name := EnvName(c.envPrefix, field)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		parsed, parseErr := ParseString(value, field.Type)
+		if parseErr != nil {
+			err = multierror.Append(err, multierror.Prefix(parseErr, name+":"))
+			continue
+		}
+
+		SetPath(m, field.Path, parsed)
+		names[field.Name()] = name
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	origin := func(path string) (Origin, bool) {
+		// Map values may be nested below the field's path
+		for name, envName := range names {
+			if path == name || strings.HasPrefix(path, name+PathSeparator) {
+				return Origin{Source: OriginEnv, Detail: envName}, true
+			}
+		}
+		return Origin{}, false
+	}
+	return m, origin, nil
+}
@@ -0,0 +1,100 @@
+package structconf
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/anexia-it/go-structconf/encoding/json"
+	"github.com/anexia-it/go-structconf/storage/file"
+	"github.com/stretchr/testify/require"
+)
+
+type TestConfigEnv struct {
+	Name     string             `config:"name"`
+	Database TestConfigDatabase `config:"database"`
+	Tags     []string           `config:"tags"`
+	Limits   map[string]int     `config:"limits"`
+}
+
+func TestEnvName(t *testing.T) {
+	field := Field{Path: []string{"database", "host"}}
+	require.EqualValues(t, "APP_DATABASE_HOST", EnvName("APP", field))
+	require.EqualValues(t, "DATABASE_HOST", EnvName("", field))
+}
+
+func newEnvTestConfiguration(t *testing.T, conf interface{}, jsonString string, options ...Option) *Configuration {
+	tempFile, err := ioutil.TempFile("", "go-structconf-test-")
+	require.NoError(t, err)
+	require.NoError(t, tempFile.Close())
+	t.Cleanup(func() {
+		os.Remove(tempFile.Name())
+	})
+	require.NoError(t, ioutil.WriteFile(tempFile.Name(), []byte(jsonString), 0640))
+
+	enc, err := json.NewJSONEncoding()
+	require.NoError(t, err)
+
+	options = append([]Option{OptionEncoding(enc), OptionStorage(file.NewFileStorage(tempFile.Name(), 0640))}, options...)
+	c, err := NewConfiguration(conf, options...)
+	require.NoError(t, err)
+	return c
+}
+
+func TestConfiguration_Load_Env(t *testing.T) {
+	t.Setenv("APP_DATABASE_HOST", "db.example.com")
+	t.Setenv("APP_TAGS", "a,b")
+	t.Setenv("APP_LIMITS", "connections=10,requests=100")
+	t.Setenv("NAME", "unprefixed")
+
+	conf := &TestConfigEnv{}
+	c := newEnvTestConfiguration(t, conf, `{"name":"test","database":{"host":"localhost","port":5432}}`,
+		OptionEnvPrefix("APP"))
+
+	require.NoError(t, c.Load())
+	require.EqualValues(t, &TestConfigEnv{
+		Name: "test",
+		Database: TestConfigDatabase{
+			Host: "db.example.com",
+			Port: 5432,
+		},
+		Tags: []string{"a", "b"},
+		Limits: map[string]int{
+			"connections": 10,
+			"requests":    100,
+		},
+	}, conf)
+}
+
+func TestConfiguration_Load_EnvNoPrefix(t *testing.T) {
+	t.Setenv("NAME", "from env")
+
+	conf := &TestConfigEnv{}
+	c := newEnvTestConfiguration(t, conf, `{"name":"test"}`, OptionEnvPrefix(""))
+
+	require.NoError(t, c.Load())
+	require.EqualValues(t, "from env", conf.Name)
+}
+
+func TestConfiguration_Load_EnvDisabled(t *testing.T) {
+	t.Setenv("NAME", "from env")
+
+	conf := &TestConfigEnv{}
+	c := newEnvTestConfiguration(t, conf, `{"name":"test"}`)
+
+	require.NoError(t, c.Load())
+	require.EqualValues(t, "test", conf.Name)
+}
+
+func TestConfiguration_Load_EnvInvalid(t *testing.T) {
+	t.Setenv("APP_DATABASE_PORT", "not a port")
+
+	conf := &TestConfigEnv{}
+	c := newEnvTestConfiguration(t, conf, `{"name":"test"}`, OptionEnvPrefix("APP"))
+
+	err := c.Load()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "APP_DATABASE_PORT")
+	// The configuration must not have been touched
+	require.EqualValues(t, &TestConfigEnv{}, conf)
+}
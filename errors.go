@@ -1,6 +1,10 @@
 package structconf
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/anexia-it/go-structconf/storage"
+)
 
 var (
 	// ErrConfigStructIsNil indicates that the passed config struct is nil
@@ -18,4 +22,24 @@ var (
 
 	// ErrStorageNotConfigured indicates that no storage was configured
 	ErrStorageNotConfigured = errors.New("Storage not configured")
+
+	// ErrNoWritableSource indicates that none of the configured sources is writable
+	ErrNoWritableSource = errors.New("No writable source configured")
+
+	// ErrSourceNameEmpty indicates that a source was configured without a name
+	ErrSourceNameEmpty = errors.New("Source name is empty")
+
+	// ErrDuplicateSource indicates that multiple sources were configured with the same name
+	ErrDuplicateSource = errors.New("Duplicate source name")
+
+	// ErrMultipleWritableSources indicates that more than one source was configured to be writable
+	ErrMultipleWritableSources = errors.New("Multiple writable sources configured")
+
+	// ErrWatchStopped indicates that Watch stopped reloading the configuration, as none of the
+	// observed storages reports changes anymore, even though the passed context is not done
+	ErrWatchStopped = errors.New("Storages stopped reporting changes")
+
+	// ErrConflict indicates that Save did not write the configuration, as the stored configuration
+	// has been changed since it was loaded
+	ErrConflict = storage.ErrConflict
 )
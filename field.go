@@ -0,0 +1,214 @@
+package structconf
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Field describes a leaf field of a configuration struct
+type Field struct {
+	// Path holds the tag names leading from the configuration struct to the field
+	Path []string
+	// Type is the type of the field
+	Type reflect.Type
+	// Tag is the struct tag of the field
+	Tag reflect.StructTag
+}
+
+// Name returns the dotted key path of the field
+func (f Field) Name() string {
+	return strings.Join(f.Path, PathSeparator)
+}
+
+// Fields returns all leaf fields of the configuration struct.
+//
+// Nested structs are traversed, unless they implement encoding.TextUnmarshaler.
+// Fields which are not exported or are ignored using the "-" tag value are skipped.
+func (c *Configuration) Fields() []Field {
+	return structFields(c.configType, c.tagName, nil)
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// isTextUnmarshaler checks if t or a pointer to t implements encoding.TextUnmarshaler
+func isTextUnmarshaler(t reflect.Type) bool {
+	return t.Implements(textUnmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// structFields collects the leaf fields of the struct type t
+func structFields(t reflect.Type, tagName string, prefix []string) (fields []Field) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		fieldD := t.Field(i)
+
+		if fieldD.Anonymous {
+			// Fields of anonymous structs are treated as fields of the embedding struct
+			if embedded := indirectType(fieldD.Type); embedded.Kind() == reflect.Struct {
+				fields = append(fields, structFields(embedded, tagName, prefix)...)
+			}
+			continue
+		}
+
+		if !unicode.IsUpper([]rune(fieldD.Name)[0]) {
+			// Ignore private fields
+			continue
+		}
+
+		name := fieldName(fieldD, tagName)
+		if name == "-" {
+			continue
+		}
+
+		path := make([]string, len(prefix)+1)
+		copy(path, prefix)
+		path[len(prefix)] = name
+
+		if fieldType := indirectType(fieldD.Type); fieldType.Kind() == reflect.Struct && !isTextUnmarshaler(fieldType) {
+			fields = append(fields, structFields(fieldType, tagName, path)...)
+			continue
+		}
+
+		fields = append(fields, Field{
+			Path: path,
+			Type: fieldD.Type,
+			Tag:  fieldD.Tag,
+		})
+	}
+
+	return
+}
+
+// fieldName returns the name a struct field is mapped to
+func fieldName(f reflect.StructField, tagName string) string {
+	name := strings.TrimSuffix(f.Tag.Get(tagName), ",omitempty")
+	if name == "" {
+		name = f.Name
+	}
+	return name
+}
+
+// indirectType returns the type t points to, if t is a pointer type
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ParseString converts the textual representation s to a value which can be applied to a field
+// of type t.
+//
+// Scalar values are parsed using the strconv package, time.Duration values using time.ParseDuration.
+// Types implementing encoding.TextUnmarshaler receive s as-is.
+// Slices and arrays are represented as comma-separated lists of their elements, like "a,b,c".
+// Maps are represented as comma-separated lists of KEY=VALUE pairs, like "a=1,b=2".
+func ParseString(s string, t reflect.Type) (interface{}, error) {
+	if isTextUnmarshaler(t) {
+		return s, nil
+	}
+
+	if t == durationType {
+		return time.ParseDuration(s)
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return ParseString(s, t.Elem())
+	case reflect.String:
+		return reflect.ValueOf(s).Convert(t).Interface(), nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.ValueOf(b).Convert(t).Interface(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 0, t.Bits())
+		if err != nil {
+			return nil, err
+		}
+		return reflect.ValueOf(i).Convert(t).Interface(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 0, t.Bits())
+		if err != nil {
+			return nil, err
+		}
+		return reflect.ValueOf(u).Convert(t).Interface(), nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return nil, err
+		}
+		return reflect.ValueOf(f).Convert(t).Interface(), nil
+	case reflect.Slice, reflect.Array:
+		return parseList(s, t)
+	case reflect.Map:
+		return parseMap(s, t)
+	}
+
+	return nil, fmt.Errorf("Parsing %s values is not supported", t.String())
+}
+
+// splitList splits a comma-separated list. An empty string results in an empty list.
+func splitList(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+// parseList parses a comma-separated list of values
+func parseList(s string, t reflect.Type) (interface{}, error) {
+	elements := splitList(s)
+	if t.Kind() == reflect.Array && len(elements) > t.Len() {
+		return nil, fmt.Errorf("Too many elements for %s: %d", t.String(), len(elements))
+	}
+
+	list := make([]interface{}, 0, len(elements))
+	for i, element := range elements {
+		v, err := ParseString(strings.TrimSpace(element), t.Elem())
+		if err != nil {
+			return nil, fmt.Errorf("@%d: %s", i, err.Error())
+		}
+		list = append(list, v)
+	}
+
+	return list, nil
+}
+
+// parseMap parses a comma-separated list of KEY=VALUE pairs
+func parseMap(s string, t reflect.Type) (interface{}, error) {
+	elements := splitList(s)
+
+	m := make(map[interface{}]interface{}, len(elements))
+	for _, element := range elements {
+		pair := strings.SplitN(element, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("Invalid KEY=VALUE pair: %s", element)
+		}
+
+		k, err := ParseString(strings.TrimSpace(pair[0]), t.Key())
+		if err != nil {
+			return nil, fmt.Errorf("@%s (key): %s", pair[0], err.Error())
+		}
+
+		v, err := ParseString(strings.TrimSpace(pair[1]), t.Elem())
+		if err != nil {
+			return nil, fmt.Errorf("@%s: %s", pair[0], err.Error())
+		}
+
+		m[k] = v
+	}
+
+	return m, nil
+}
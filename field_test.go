@@ -0,0 +1,112 @@
+package structconf
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type TestConfigDatabase struct {
+	Host string `config:"host"`
+	Port uint16 `config:"port,omitempty"`
+}
+
+type TestConfigFields struct {
+	sync.Mutex
+	TestConfigSimple
+
+	Database *TestConfigDatabase `config:"database"`
+	Timeout  time.Duration       `config:"timeout"`
+	Address  net.IP              `config:"address"`
+	Tags     []string            `config:"tags"`
+	Limits   map[string]int      `config:"limits"`
+	Untagged bool
+	Ignored  string `config:"-"`
+	private  string
+}
+
+func TestConfiguration_Fields(t *testing.T) {
+	c, err := NewConfiguration(&TestConfigFields{})
+	require.NoError(t, err)
+
+	fields := c.Fields()
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.Name()
+	}
+
+	require.EqualValues(t, []string{
+		"test",
+		"database.host",
+		"database.port",
+		"timeout",
+		"address",
+		"tags",
+		"limits",
+		"Untagged",
+	}, names)
+
+	require.EqualValues(t, []string{"database", "port"}, fields[2].Path)
+	require.EqualValues(t, reflect.TypeOf(uint16(0)), fields[2].Type)
+	require.EqualValues(t, "port,omitempty", fields[2].Tag.Get("config"))
+}
+
+func TestParseString(t *testing.T) {
+	type customString string
+
+	testCases := []struct {
+		in       string
+		t        reflect.Type
+		expected interface{}
+	}{
+		{"test", reflect.TypeOf(""), "test"},
+		{"test", reflect.TypeOf(customString("")), customString("test")},
+		{"true", reflect.TypeOf(false), true},
+		{"-42", reflect.TypeOf(0), -42},
+		{"0x10", reflect.TypeOf(int8(0)), int8(16)},
+		{"42", reflect.TypeOf(uint16(0)), uint16(42)},
+		{"1.5", reflect.TypeOf(float32(0)), float32(1.5)},
+		{"1m30s", reflect.TypeOf(time.Duration(0)), 90 * time.Second},
+		{"127.0.0.1", reflect.TypeOf(net.IP{}), "127.0.0.1"},
+		{"42", reflect.TypeOf((*int)(nil)), 42},
+		{"a, b,c", reflect.TypeOf([]string{}), []interface{}{"a", "b", "c"}},
+		{"", reflect.TypeOf([]string{}), []interface{}{}},
+		{"1,2", reflect.TypeOf([3]int{}), []interface{}{1, 2}},
+		{"a=1, b=2", reflect.TypeOf(map[string]int{}), map[interface{}]interface{}{"a": 1, "b": 2}},
+		{"1=a=b", reflect.TypeOf(map[int]string{}), map[interface{}]interface{}{1: "a=b"}},
+	}
+
+	for _, testCase := range testCases {
+		result, err := ParseString(testCase.in, testCase.t)
+		require.NoError(t, err, "Parsing %q as %s", testCase.in, testCase.t)
+		require.EqualValues(t, testCase.expected, result, "Parsing %q as %s", testCase.in, testCase.t)
+	}
+}
+
+func TestParseString_Errors(t *testing.T) {
+	testCases := []struct {
+		in string
+		t  reflect.Type
+	}{
+		{"yes please", reflect.TypeOf(false)},
+		{"128", reflect.TypeOf(int8(0))},
+		{"-1", reflect.TypeOf(uint(0))},
+		{"one", reflect.TypeOf(float64(0))},
+		{"1 hour", reflect.TypeOf(time.Duration(0))},
+		{"1,two", reflect.TypeOf([]int{})},
+		{"1,2,3", reflect.TypeOf([2]int{})},
+		{"a", reflect.TypeOf(map[string]int{})},
+		{"a=b", reflect.TypeOf(map[int]string{})},
+		{"a=b", reflect.TypeOf(map[string]int{})},
+		{"test", reflect.TypeOf(struct{}{})},
+	}
+
+	for _, testCase := range testCases {
+		_, err := ParseString(testCase.in, testCase.t)
+		require.Error(t, err, "Parsing %q as %s", testCase.in, testCase.t)
+	}
+}
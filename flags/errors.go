@@ -0,0 +1,8 @@
+package flags
+
+import "errors"
+
+var (
+	// ErrNotParsed indicates that the flag set has not been parsed yet
+	ErrNotParsed = errors.New("Flag set has not been parsed")
+)
@@ -0,0 +1,126 @@
+// Package flags provides command-line flag bindings for go-structconf configurations
+package flags
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/anexia-it/go-structconf"
+)
+
+// DescriptionTagName defines the name of the struct tag holding the usage text of a flag
+const DescriptionTagName = "desc"
+
+// OverlayName defines the name of the overlay the flags are applied with
+const OverlayName = "flags"
+
+// Binding represents the flags registered for the fields of a configuration
+type Binding struct {
+	conf    *structconf.Configuration
+	flagSet *flag.FlagSet
+	values  map[string]*value
+}
+
+// Bind registers a flag on the flag set for every leaf field of the configuration.
+//
+// Flag names are the dotted key paths of the fields, like "database.host", the usage text
+// is taken from the "desc" struct tag and the default value is the field's current value.
+// Values are parsed using structconf.ParseString.
+func Bind(flagSet *flag.FlagSet, conf *structconf.Configuration) (*Binding, error) {
+	currentMap, err := conf.Map()
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Binding{
+		conf:    conf,
+		flagSet: flagSet,
+		values:  make(map[string]*value),
+	}
+
+	for _, field := range conf.Fields() {
+		name := field.Name()
+
+		v := &value{
+			field: field,
+			raw:   formatValue(structconf.LookupPath(currentMap, field.Path)),
+		}
+
+		flagSet.Var(v, name, field.Tag.Get(DescriptionTagName))
+		b.values[name] = v
+	}
+
+	return b, nil
+}
+
+// Apply applies the flags which were explicitly set on the command line on top of the configuration.
+//
+// Apply has to be called after the flag set has been parsed. The flags are kept as an overlay named "flags",
+// so they take precedence over the storage's values on subsequent loads as well. The provenance of the
+// values reports the name of the flag they were set with.
+func (b *Binding) Apply() error {
+	if !b.flagSet.Parsed() {
+		return ErrNotParsed
+	}
+
+	m := make(map[string]interface{})
+	b.flagSet.Visit(func(f *flag.Flag) {
+		v, ok := b.values[f.Name]
+		if !ok {
+			// Flag was not registered by us
+			return
+		}
+		structconf.SetPath(m, v.field.Path, v.parsed)
+	})
+
+	return b.conf.Overlay(OverlayName, m, structconf.OverlayDetail(b.flagName))
+}
+
+// flagName returns the name of the flag, including the leading dash, which sets the value
+// at the given dotted key path
+func (b *Binding) flagName(path string) string {
+	// Elements of map values are set using the flag of the map field
+	elements := structconf.SplitPath(path)
+	for i := len(elements); i > 0; i-- {
+		if name := strings.Join(elements[:i], structconf.PathSeparator); b.values[name] != nil {
+			return "-" + name
+		}
+	}
+	return ""
+}
+
+// formatValue formats a value of a configuration's map representation,
+// so it can be parsed by structconf.ParseString again
+func formatValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return ""
+		}
+		return formatValue(rv.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		elements := make([]string, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			elements[i] = formatValue(rv.Index(i).Interface())
+		}
+		return strings.Join(elements, ",")
+	case reflect.Map:
+		pairs := make([]string, 0, rv.Len())
+		for _, k := range rv.MapKeys() {
+			pairs = append(pairs, formatValue(k.Interface())+"="+formatValue(rv.MapIndex(k).Interface()))
+		}
+		// Ensure a stable order
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	}
+
+	return fmt.Sprint(v)
+}
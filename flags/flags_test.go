@@ -0,0 +1,155 @@
+package flags_test
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/anexia-it/go-structconf"
+	"github.com/anexia-it/go-structconf/encoding/json"
+	"github.com/anexia-it/go-structconf/flags"
+	"github.com/anexia-it/go-structconf/storage/file"
+	"github.com/stretchr/testify/require"
+)
+
+type testDatabaseConfig struct {
+	Host string `config:"host" desc:"database host"`
+	Port int    `config:"port" desc:"database port"`
+}
+
+type testConfig struct {
+	Debug    bool               `config:"debug" desc:"enable debug output"`
+	Timeout  time.Duration      `config:"timeout"`
+	Tags     []string           `config:"tags"`
+	Limits   map[string]int     `config:"limits"`
+	Database testDatabaseConfig `config:"database"`
+}
+
+func newTestBinding(t *testing.T, conf *testConfig, options ...structconf.Option) (*flag.FlagSet, *flags.Binding, *structconf.Configuration) {
+	c, err := structconf.NewConfiguration(conf, options...)
+	require.NoError(t, err)
+
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.SetOutput(ioutil.Discard)
+
+	b, err := flags.Bind(flagSet, c)
+	require.NoError(t, err)
+	require.NotNil(t, b)
+
+	return flagSet, b, c
+}
+
+func TestBind(t *testing.T) {
+	conf := &testConfig{
+		Timeout: 5 * time.Second,
+		Tags:    []string{"a", "b"},
+		Limits: map[string]int{
+			"b": 2,
+			"a": 1,
+		},
+		Database: testDatabaseConfig{
+			Host: "localhost",
+			Port: 5432,
+		},
+	}
+	flagSet, _, _ := newTestBinding(t, conf)
+
+	expected := map[string][2]string{
+		"debug":         {"enable debug output", "false"},
+		"timeout":       {"", "5s"},
+		"tags":          {"", "a,b"},
+		"limits":        {"", "a=1,b=2"},
+		"database.host": {"database host", "localhost"},
+		"database.port": {"database port", "5432"},
+	}
+
+	registered := 0
+	flagSet.VisitAll(func(f *flag.Flag) {
+		registered++
+		e, ok := expected[f.Name]
+		require.True(t, ok, "Unexpected flag %s", f.Name)
+		require.EqualValues(t, e[0], f.Usage, "Usage of %s", f.Name)
+		require.EqualValues(t, e[1], f.DefValue, "Default value of %s", f.Name)
+	})
+	require.EqualValues(t, len(expected), registered)
+}
+
+func TestBinding_Apply(t *testing.T) {
+	conf := &testConfig{
+		Timeout: 5 * time.Second,
+		Database: testDatabaseConfig{
+			Host: "localhost",
+			Port: 5432,
+		},
+	}
+	flagSet, b, _ := newTestBinding(t, conf)
+
+	require.EqualError(t, b.Apply(), flags.ErrNotParsed.Error())
+
+	require.NoError(t, flagSet.Parse([]string{"-debug", "-database.port", "6543", "-tags", "x,y"}))
+	require.NoError(t, b.Apply())
+
+	require.EqualValues(t, &testConfig{
+		Debug:   true,
+		Timeout: 5 * time.Second,
+		Tags:    []string{"x", "y"},
+		// Nil maps are initialized by the mapper
+		Limits: map[string]int{},
+		Database: testDatabaseConfig{
+			Host: "localhost",
+			Port: 6543,
+		},
+	}, conf)
+}
+
+func TestBinding_ApplyInvalidValue(t *testing.T) {
+	flagSet, _, _ := newTestBinding(t, &testConfig{})
+
+	require.Error(t, flagSet.Parse([]string{"-database.port", "not a port"}))
+}
+
+func TestBinding_ApplyPrecedenceOverLoad(t *testing.T) {
+	tempFile, err := ioutil.TempFile("", "go-structconf-test-")
+	require.NoError(t, err)
+	require.NoError(t, tempFile.Close())
+	defer os.Remove(tempFile.Name())
+
+	require.NoError(t, ioutil.WriteFile(tempFile.Name(),
+		[]byte(`{"database":{"host":"db.example.com","port":1234}}`), 0640))
+
+	enc, err := json.NewJSONEncoding()
+	require.NoError(t, err)
+
+	conf := &testConfig{}
+	flagSet, b, c := newTestBinding(t, conf,
+		structconf.OptionEncoding(enc),
+		structconf.OptionStorage(file.NewFileStorage(tempFile.Name(), 0640)))
+
+	require.NoError(t, flagSet.Parse([]string{"-database.port", "6543"}))
+	require.NoError(t, b.Apply())
+	require.NoError(t, c.Load())
+
+	// Only the explicitly set flag overrides the loaded configuration
+	require.EqualValues(t, "db.example.com", conf.Database.Host)
+	require.EqualValues(t, 6543, conf.Database.Port)
+}
+
+func TestBinding_ApplyProvenance(t *testing.T) {
+	flagSet, b, c := newTestBinding(t, &testConfig{})
+
+	require.NoError(t, flagSet.Parse([]string{"-database.port", "6543", "-limits", "a=1"}))
+	require.NoError(t, b.Apply())
+
+	origin, ok := c.Provenance("database.port")
+	require.True(t, ok)
+	require.EqualValues(t, structconf.Origin{Source: flags.OverlayName, Detail: "-database.port"}, origin)
+
+	origin, ok = c.Provenance("limits.a")
+	require.True(t, ok)
+	require.EqualValues(t, structconf.Origin{Source: flags.OverlayName, Detail: "-limits"}, origin)
+
+	_, ok = c.Provenance("database.host")
+	require.False(t, ok)
+}
@@ -0,0 +1,48 @@
+package flags
+
+import (
+	"flag"
+	"reflect"
+
+	"github.com/anexia-it/go-structconf"
+)
+
+var _ flag.Value = (*value)(nil)
+
+// value implements flag.Value for a configuration field
+type value struct {
+	field  structconf.Field
+	raw    string
+	parsed interface{}
+}
+
+func (v *value) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.raw
+}
+
+func (v *value) Set(s string) error {
+	parsed, err := structconf.ParseString(s, v.field.Type)
+	if err != nil {
+		return err
+	}
+
+	v.raw = s
+	v.parsed = parsed
+	return nil
+}
+
+// IsBoolFlag allows boolean fields to be set without a value, like "-debug"
+func (v *value) IsBoolFlag() bool {
+	if v == nil || v.field.Type == nil {
+		return false
+	}
+
+	t := v.field.Type
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Bool
+}
@@ -32,6 +32,22 @@ func OptionTagName(tagName string) Option {
 	}
 }
 
+// OptionMergeStrategy configures how Load merges the values of the storages, environment variables
+// and overlays on top of the current configuration.
+//
+// By default, MergePresent is used, which means every key present in a storage's document takes
+// precedence, even if its value is a zero-value like false or 0, while keys absent from the document
+// keep their current or default value. MergeNonZero restores the behavior of earlier versions, where
+// zero-values were treated like absent keys.
+// SetDefaults always uses MergeNonZero, as unset fields of the config struct cannot be told apart from
+// zero-values.
+func OptionMergeStrategy(strategy MergeStrategy) Option {
+	return func(c *Configuration) error {
+		c.mergeStrategy = strategy
+		return nil
+	}
+}
+
 // OptionDefaults configures the default values from a struct
 // This requires an encoding to be configured before-hand and will
 // return an error if no encoding was configured
@@ -41,3 +57,71 @@ func OptionDefaults(defaults interface{}) Option {
 		return nil
 	}
 }
+
+// OptionWatchErrorHandler configures a function which is called with every error
+// that occurs while reloading the configuration during Watch
+func OptionWatchErrorHandler(handler func(error)) Option {
+	return func(c *Configuration) error {
+		c.watchErrorHandler = handler
+		return nil
+	}
+}
+
+// OptionEnvPrefix enables overriding configuration values using environment variables.
+//
+// During Load, every field of the configuration struct is looked up using an environment variable
+// named after the prefix and the upper-cased tag names of the field and its parents, joined by "_".
+// The value of the field "host" inside the nested struct "database" would be read from APP_DATABASE_HOST,
+// given the prefix "APP". An empty prefix omits the prefix and its separator.
+//
+// Values are converted to the field's type using ParseString, which means slices are expected as
+// comma-separated lists ("a,b,c") and maps as comma-separated KEY=VALUE pairs ("a=1,b=2").
+func OptionEnvPrefix(prefix string) Option {
+	return func(c *Configuration) error {
+		c.env = true
+		c.envPrefix = prefix
+		return nil
+	}
+}
+
+// OptionSource configures an additional configuration source.
+//
+// Sources are loaded in order of their priority, values of sources with a higher priority
+// override values of sources with a lower priority. The storage and encoding configured
+// using OptionStorage and OptionEncoding form a source named "storage" with priority 0.
+// Source names must be unique and at most one source may be configured to be writable.
+func OptionSource(name string, s storage.Storage, e encoding.Encoding, priority int, options ...SourceOption) Option {
+	return func(c *Configuration) error {
+		if name == "" {
+			return ErrSourceNameEmpty
+		} else if s == nil {
+			return ErrStorageNotConfigured
+		} else if e == nil {
+			return ErrEncodingNotConfigured
+		}
+
+		src := &source{
+			name:     name,
+			storage:  s,
+			encoding: e,
+			priority: priority,
+		}
+		for _, opt := range options {
+			opt(src)
+		}
+
+		for _, existing := range c.sources {
+			if existing.name == name {
+				return ErrDuplicateSource
+			} else if existing.writable && src.writable {
+				return ErrMultipleWritableSources
+			}
+		}
+		if name == DefaultSourceName {
+			return ErrDuplicateSource
+		}
+
+		c.sources = append(c.sources, src)
+		return nil
+	}
+}
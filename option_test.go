@@ -1,6 +1,7 @@
 package structconf
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -52,3 +53,41 @@ func TestOptionDefaults(t *testing.T) {
 	// Check if the defaults were correctly applied to the config
 	require.EqualValues(t, defaults, conf.config)
 }
+
+func TestOptionWatchErrorHandler(t *testing.T) {
+	c := &TestConfigSimple{}
+
+	var handledErr error
+	conf, err := NewConfiguration(c, OptionWatchErrorHandler(func(err error) {
+		handledErr = err
+	}))
+	require.NoError(t, err)
+	require.NotNil(t, conf)
+	require.NotNil(t, conf.watchErrorHandler)
+
+	testErr := errors.New("test error")
+	conf.watchErrorHandler(testErr)
+	require.EqualValues(t, testErr, handledErr)
+}
+
+func TestOptionEnvPrefix(t *testing.T) {
+	c := &TestConfigSimple{}
+
+	conf, err := NewConfiguration(c, OptionEnvPrefix("APP"))
+	require.NoError(t, err)
+	require.NotNil(t, conf)
+	require.True(t, conf.env)
+	require.EqualValues(t, "APP", conf.envPrefix)
+}
+
+func TestOptionMergeStrategy(t *testing.T) {
+	c := &TestConfigSimple{}
+
+	conf, err := NewConfiguration(c)
+	require.NoError(t, err)
+	require.EqualValues(t, MergePresent, conf.mergeStrategy)
+
+	conf, err = NewConfiguration(c, OptionMergeStrategy(MergeNonZero))
+	require.NoError(t, err)
+	require.EqualValues(t, MergeNonZero, conf.mergeStrategy)
+}
@@ -0,0 +1,73 @@
+package structconf
+
+// OverlayOption defines the function type of overlay options
+type OverlayOption func(*overlay)
+
+// OverlayDetail configures a function which returns the origin detail reported by Provenance for
+// the values of an overlay, like the name of the command-line flag the value was set with.
+// The function receives the dotted key path of a value.
+func OverlayDetail(detail func(path string) string) OverlayOption {
+	return func(o *overlay) {
+		o.detail = detail
+	}
+}
+
+// overlay represents a named map representation which is applied on top of the loaded configuration
+type overlay struct {
+	name   string
+	values map[string]interface{}
+	detail func(path string) string
+}
+
+// origin returns the origin of the overlay's value at the given path
+func (o *overlay) origin(path string) (Origin, bool) {
+	origin := Origin{Source: o.name}
+	if o.detail != nil {
+		origin.Detail = o.detail(path)
+	}
+	return origin, true
+}
+
+// Overlay applies the passed map representation on top of the loaded configuration and keeps it,
+// so it is re-applied on top of the storage's values and environment variables every time the
+// configuration is loaded.
+//
+// Overlays are applied in the order they were first added. Calling Overlay again with the name
+// of an existing overlay replaces that overlay's values. Once the configuration has been loaded,
+// values only present in the previous values are reset.
+func (c *Configuration) Overlay(name string, values map[string]interface{}, options ...OverlayOption) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	o := overlay{
+		name:   name,
+		values: values,
+	}
+	for _, opt := range options {
+		opt(&o)
+	}
+
+	overlays := append([]overlay(nil), c.overlays...)
+	replaced := false
+	for i := range overlays {
+		if overlays[i].name == name {
+			overlays[i] = o
+			replaced = true
+		}
+	}
+	if !replaced {
+		overlays = append(overlays, o)
+	}
+
+	base, baseOrigin, err := c.currentBase()
+	if err != nil {
+		return err
+	}
+
+	if err := c.rebuild(base, baseOrigin, c.loaded, c.loadedOrigins, overlays); err != nil {
+		return err
+	}
+
+	c.overlays = overlays
+	return nil
+}
@@ -0,0 +1,71 @@
+package structconf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfiguration_Overlay(t *testing.T) {
+	conf := &TestConfigEnv{
+		Name: "test",
+	}
+
+	c := newEnvTestConfiguration(t, conf, `{"name":"loaded","database":{"host":"localhost"}}`)
+
+	require.NoError(t, c.Overlay("first", map[string]interface{}{
+		"database": map[string]interface{}{
+			"host": "first.example.com",
+		},
+	}))
+	require.EqualValues(t, "test", conf.Name)
+	require.EqualValues(t, "first.example.com", conf.Database.Host)
+
+	require.NoError(t, c.Overlay("second", map[string]interface{}{
+		"name": "second",
+	}))
+	require.Len(t, c.overlays, 2)
+
+	// Overlays take precedence over loaded values
+	require.NoError(t, c.Load())
+	require.EqualValues(t, "second", conf.Name)
+	require.EqualValues(t, "first.example.com", conf.Database.Host)
+
+	// Replacing an overlay keeps its position
+	require.NoError(t, c.Overlay("first", map[string]interface{}{
+		"name": "first",
+	}))
+	require.Len(t, c.overlays, 2)
+	require.EqualValues(t, "first", c.overlays[0].name)
+
+	require.NoError(t, c.Load())
+	require.EqualValues(t, "second", conf.Name)
+	require.EqualValues(t, "localhost", conf.Database.Host)
+}
+
+func TestConfiguration_Overlay_Error(t *testing.T) {
+	conf := &TestConfigEnv{}
+	c, err := NewConfiguration(conf)
+	require.NoError(t, err)
+
+	require.Error(t, c.Overlay("invalid", map[string]interface{}{
+		"database": "not a map",
+	}))
+	require.Empty(t, c.overlays)
+}
+
+func TestConfiguration_Map(t *testing.T) {
+	conf := &TestConfigWithLocker{
+		TestConfigSimple: TestConfigSimple{
+			Test: "test",
+		},
+	}
+	c, err := NewConfiguration(conf)
+	require.NoError(t, err)
+
+	m, err := c.Map()
+	require.NoError(t, err)
+	require.EqualValues(t, map[string]interface{}{"test": "test"}, m)
+	require.EqualValues(t, 1, conf.lockCalled)
+	require.EqualValues(t, 1, conf.unlockCalled)
+}
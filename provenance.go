@@ -0,0 +1,177 @@
+package structconf
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// OriginDefaults is the source name of values set using SetDefaults or OptionDefaults
+	OriginDefaults = "defaults"
+
+	// OriginEnv is the source name of values set using environment variables
+	OriginEnv = "env"
+)
+
+// Origin describes where the value of a configuration key was set
+type Origin struct {
+	// Source is the name of the source which set the value, like "defaults", "env",
+	// the name of a source configured using OptionSource or the name of an overlay
+	Source string
+	// Detail identifies the value inside the source, like the path of a file or the name
+	// of an environment variable. Detail may be empty.
+	Detail string
+}
+
+// String returns a human readable representation of the origin
+func (o Origin) String() string {
+	if o.Detail == "" {
+		return o.Source
+	}
+	return fmt.Sprintf("%s (%s)", o.Source, o.Detail)
+}
+
+// originFunc returns the origin of the value at the given dotted key path.
+// If the origin is not known, false is returned.
+type originFunc func(path string) (Origin, bool)
+
+// staticOrigin returns an originFunc which reports the same origin for every path
+func staticOrigin(origin Origin) originFunc {
+	return func(string) (Origin, bool) {
+		return origin, true
+	}
+}
+
+// Provenance returns the origin of the value at the given dotted key path.
+//
+// If no origin was recorded for the path itself, the origin of the closest parent path is returned,
+// which allows looking up the origin of elements of maps that were set as a whole.
+// If no origin is known, false is returned.
+func (c *Configuration) Provenance(path string) (Origin, bool) {
+	c.provenanceMutex.RLock()
+	defer c.provenanceMutex.RUnlock()
+
+	elements := SplitPath(path)
+	for i := len(elements); i > 0; i-- {
+		if origin, ok := c.provenance[strings.Join(elements[:i], PathSeparator)]; ok {
+			return origin, true
+		}
+	}
+	return Origin{}, false
+}
+
+// Explain returns a human readable listing of all configuration values along with their origin
+func (c *Configuration) Explain() string {
+	m, err := c.Map()
+	if err != nil {
+		return err.Error()
+	}
+
+	leaves := make(map[string]interface{})
+	flattenMap(leaves, nil, m)
+
+	paths := make([]string, 0, len(leaves))
+	for path := range leaves {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var sb strings.Builder
+	for _, path := range paths {
+		origin, ok := c.Provenance(path)
+		if !ok {
+			origin = Origin{Source: "unknown"}
+		}
+		value := leaves[path]
+		if str, ok := value.(string); ok {
+			// Quote strings, so empty values and whitespace remain visible
+			value = strconv.Quote(str)
+		}
+		fmt.Fprintf(&sb, "%s = %v (%s)\n", path, value, origin)
+	}
+	return sb.String()
+}
+
+// provenanceOrigin returns an originFunc reporting the currently recorded origins
+func (c *Configuration) provenanceOrigin() originFunc {
+	c.provenanceMutex.RLock()
+	defer c.provenanceMutex.RUnlock()
+
+	current := make(map[string]Origin, len(c.provenance))
+	for path, origin := range c.provenance {
+		current[path] = origin
+	}
+	return mapOrigin(current)
+}
+
+// mapOrigin returns an originFunc reporting the origins recorded in provenance
+func mapOrigin(provenance map[string]Origin) originFunc {
+	return func(path string) (Origin, bool) {
+		origin, ok := provenance[path]
+		return origin, ok
+	}
+}
+
+// setProvenance replaces all recorded origins
+func (c *Configuration) setProvenance(provenance map[string]Origin) {
+	c.provenanceMutex.Lock()
+	defer c.provenanceMutex.Unlock()
+
+	c.provenance = provenance
+}
+
+// collectProvenance adds the origins of the values applied from the passed maps to provenance.
+// maps and origins are expected to be in the order they have been merged in using the given strategy.
+func collectProvenance(provenance map[string]Origin, strategy MergeStrategy, maps []map[string]interface{}, origins []originFunc) {
+	for i, m := range maps {
+		leaves := make(map[string]interface{})
+		flattenMap(leaves, nil, m)
+
+		for path, value := range leaves {
+			if !overridesValue(value, strategy) {
+				// The value did not take precedence during merging
+				continue
+			}
+
+			if origin, ok := origins[i](path); ok {
+				provenance[path] = origin
+			} else {
+				delete(provenance, path)
+			}
+		}
+	}
+}
+
+// overridesValue checks if a value overrides an existing value when merged using the given strategy
+func overridesValue(v interface{}, strategy MergeStrategy) bool {
+	if v == nil {
+		return false
+	} else if strategy == MergePresent {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	if (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && rv.Len() == 0 {
+		return false
+	}
+	return !rv.IsZero()
+}
+
+// flattenMap collects the leaf values of a map representation of a configuration
+// by their dotted key path
+func flattenMap(leaves map[string]interface{}, prefix []string, m interface{}) {
+	mv := reflect.ValueOf(m)
+	for _, k := range mv.MapKeys() {
+		path := append(prefix[:len(prefix):len(prefix)], fmt.Sprint(k.Interface()))
+		v := mv.MapIndex(k).Interface()
+
+		if v != nil && reflect.ValueOf(v).Kind() == reflect.Map {
+			flattenMap(leaves, path, v)
+			continue
+		}
+		leaves[strings.Join(path, PathSeparator)] = v
+	}
+}
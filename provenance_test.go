@@ -0,0 +1,97 @@
+package structconf
+
+import (
+	"testing"
+
+	"github.com/anexia-it/go-structconf/storage/aferofile"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrigin_String(t *testing.T) {
+	require.EqualValues(t, "defaults", Origin{Source: OriginDefaults}.String())
+	require.EqualValues(t, "env (APP_NAME)", Origin{Source: OriginEnv, Detail: "APP_NAME"}.String())
+}
+
+func TestConfiguration_Provenance(t *testing.T) {
+	t.Setenv("APP_LIMITS", "connections=10")
+
+	enc := newTestEncodings(t)
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/etc/app/config.yaml",
+		[]byte("name: system\ndatabase:\n  host: system.example.com\n"), 0640))
+	require.NoError(t, afero.WriteFile(fs, "/app.json", []byte(`{"database":{"host":"local.example.com"}}`), 0640))
+
+	conf := &TestConfigEnv{}
+	c, err := NewConfiguration(conf,
+		OptionDefaults(&TestConfigEnv{
+			Name: "default",
+			Database: TestConfigDatabase{
+				Port: 5432,
+			},
+		}),
+		OptionSource("system", aferofile.NewAferoFileStorage(fs, "/etc/app/config.yaml", 0640), enc.yaml, 10),
+		OptionSource("local", aferofile.NewAferoFileStorage(fs, "/app.json", 0640), enc.json, 20),
+		OptionEnvPrefix("APP"))
+	require.NoError(t, err)
+
+	// Only the defaults have been applied so far
+	origin, ok := c.Provenance("name")
+	require.True(t, ok)
+	require.EqualValues(t, Origin{Source: OriginDefaults}, origin)
+
+	_, ok = c.Provenance("database.host")
+	require.False(t, ok)
+
+	require.NoError(t, c.Load())
+
+	expected := map[string]Origin{
+		"name":               {Source: "system", Detail: "/etc/app/config.yaml"},
+		"database.host":      {Source: "local", Detail: "/app.json"},
+		"database.port":      {Source: OriginDefaults},
+		"limits.connections": {Source: OriginEnv, Detail: "APP_LIMITS"},
+		// Parent paths are resolved
+		"limits.connections.nested": {Source: OriginEnv, Detail: "APP_LIMITS"},
+	}
+	for path, expectedOrigin := range expected {
+		origin, ok := c.Provenance(path)
+		require.True(t, ok, "No provenance for %s", path)
+		require.EqualValues(t, expectedOrigin, origin, "Provenance of %s", path)
+	}
+
+	_, ok = c.Provenance("tags")
+	require.False(t, ok)
+
+	// Overlays are reported with their name and detail
+	require.NoError(t, c.Overlay("flags", map[string]interface{}{
+		"name": "flag",
+	}, OverlayDetail(func(path string) string {
+		return "-" + path
+	})))
+	origin, ok = c.Provenance("name")
+	require.True(t, ok)
+	require.EqualValues(t, Origin{Source: "flags", Detail: "-name"}, origin)
+
+	// Setting defaults keeps the origin of values that are already set
+	require.NoError(t, c.SetDefaults(&TestConfigEnv{Name: "other default", Tags: []string{"default"}}))
+	origin, ok = c.Provenance("name")
+	require.True(t, ok)
+	require.EqualValues(t, Origin{Source: "flags", Detail: "-name"}, origin)
+	origin, ok = c.Provenance("tags")
+	require.True(t, ok)
+	require.EqualValues(t, Origin{Source: OriginDefaults}, origin)
+
+	require.EqualValues(t, `database.host = "local.example.com" (local (/app.json))
+database.port = 5432 (defaults)
+limits.connections = 10 (env (APP_LIMITS))
+name = "flag" (flags (-name))
+tags = [default] (defaults)
+`, c.Explain())
+}
+
+func TestConfiguration_Explain_Unknown(t *testing.T) {
+	c, err := NewConfiguration(&TestConfigSimple{Test: "initial"})
+	require.NoError(t, err)
+
+	require.EqualValues(t, "test = \"initial\" (unknown)\n", c.Explain())
+}
@@ -0,0 +1,176 @@
+package structconf
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/anexia-it/go-structconf/encoding"
+	"github.com/anexia-it/go-structconf/storage"
+)
+
+// DefaultSourceName defines the name of the source configured using OptionStorage and OptionEncoding
+const DefaultSourceName = "storage"
+
+// SourceOption defines the function type of source options
+type SourceOption func(*source)
+
+// SourceOptional marks a source as optional.
+// Load skips optional sources whose storage reports that no configuration exists.
+func SourceOptional() SourceOption {
+	return func(s *source) {
+		s.optional = true
+	}
+}
+
+// SourceWritable designates the source Save writes the configuration to
+func SourceWritable() SourceOption {
+	return func(s *source) {
+		s.writable = true
+	}
+}
+
+// source represents a storage along with the encoding of its data
+type source struct {
+	name     string
+	storage  storage.Storage
+	encoding encoding.Encoding
+	priority int
+	optional bool
+	writable bool
+}
+
+// document represents a decoded configuration document along with the origin of its values
+type document struct {
+	values map[string]interface{}
+	origin Origin
+}
+
+// read reads and decodes the source's configuration documents along with their version,
+// see readDocuments.
+// If the source is optional and its configuration does not exist, no documents are returned.
+func (s *source) read() ([]document, storage.Version, error) {
+	docs, version, err := readDocuments(s.storage)
+	if err != nil {
+		if s.optional && errors.Is(err, storage.ErrNotExist) {
+			return nil, version, nil
+		}
+		// Storage reported error
+		return nil, storage.NoVersion, err
+	}
+
+	documents := make([]document, 0, len(docs))
+	for _, doc := range docs {
+		// Decode onto map[string]interface{}
+		loadedMap := make(map[string]interface{})
+		if err := s.encoding.UnmarshalTo(doc.Data, loadedMap); err != nil {
+			// Encoding error
+			if doc.Name != "" {
+				err = fmt.Errorf("%s: %w", doc.Name, err)
+			}
+			return nil, storage.NoVersion, err
+		}
+
+		origin := s.origin()
+		if doc.Name != "" {
+			origin.Detail = doc.Name
+		}
+		documents = append(documents, document{values: loadedMap, origin: origin})
+	}
+
+	return documents, version, nil
+}
+
+// readDocuments reads the configuration documents from the storage along with their version.
+// Storages which do not implement storage.MultiDocument provide a single unnamed document.
+// Multiple documents are not versioned, see readVersion.
+func readDocuments(s storage.Storage) ([]storage.Document, storage.Version, error) {
+	if multi, ok := s.(storage.MultiDocument); ok {
+		docs, err := multi.ReadConfigs()
+		return docs, storage.AnyVersion, err
+	}
+
+	buf, version, err := readVersion(s)
+	if err != nil {
+		return nil, version, err
+	}
+	return []storage.Document{{Data: buf}}, version, nil
+}
+
+// readVersion reads the configuration bytes from the storage along with their version.
+// If the storage does not support versions, storage.AnyVersion is returned as version, so saving
+// does not depend on the stored version.
+func readVersion(s storage.Storage) ([]byte, storage.Version, error) {
+	if versioned, ok := s.(storage.Versioned); ok {
+		buf, version, err := versioned.ReadConfigVersion()
+		if !errors.Is(err, storage.ErrVersionNotSupported) {
+			return buf, version, err
+		}
+	}
+
+	buf, err := s.ReadConfig()
+	return buf, storage.AnyVersion, err
+}
+
+// origin returns the origin of the source's values.
+// Storages implementing fmt.Stringer, like file-based storages, provide the detail.
+func (s *source) origin() Origin {
+	origin := Origin{Source: s.name}
+	if stringer, ok := s.storage.(fmt.Stringer); ok {
+		origin.Detail = stringer.String()
+	}
+	return origin
+}
+
+// sourceError wraps errors of sources configured using OptionSource with the source's name.
+// Errors of the default source are passed as-is.
+func sourceError(s *source, err error) error {
+	if s.name == DefaultSourceName {
+		return err
+	}
+	return fmt.Errorf("source %s: %w", s.name, err)
+}
+
+// layers returns all sources ordered by their priority, lowest priority first.
+//
+// The storage and encoding configured using OptionStorage and OptionEncoding are part of the
+// returned sources as source "storage" with priority 0. It is writable, unless another source was
+// configured to be writable.
+func (c *Configuration) layers() ([]*source, error) {
+	if len(c.sources) == 0 || c.storage != nil {
+		// Check if encoding and storage were configured
+		if c.encoding == nil {
+			return nil, ErrEncodingNotConfigured
+		} else if c.storage == nil {
+			return nil, ErrStorageNotConfigured
+		}
+	}
+
+	layers := make([]*source, 0, len(c.sources)+1)
+	if c.storage != nil {
+		layers = append(layers, &source{
+			name:     DefaultSourceName,
+			storage:  c.storage,
+			encoding: c.encoding,
+			writable: c.writableSource() == nil,
+		})
+	}
+	layers = append(layers, c.sources...)
+
+	// Sources of the same priority are kept in the order they were configured in
+	sort.SliceStable(layers, func(i, j int) bool {
+		return layers[i].priority < layers[j].priority
+	})
+
+	return layers, nil
+}
+
+// writableSource returns the source configured using SourceWritable, if any
+func (c *Configuration) writableSource() *source {
+	for _, s := range c.sources {
+		if s.writable {
+			return s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package structconf
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/anexia-it/go-structconf/encoding"
+	"github.com/anexia-it/go-structconf/encoding/json"
+	"github.com/anexia-it/go-structconf/encoding/toml"
+	"github.com/anexia-it/go-structconf/encoding/yaml"
+	"github.com/anexia-it/go-structconf/storage"
+	"github.com/anexia-it/go-structconf/storage/aferodir"
+	"github.com/anexia-it/go-structconf/storage/aferofile"
+	"github.com/golang/mock/gomock"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+type testEncodings struct {
+	json encoding.Encoding
+	yaml encoding.Encoding
+	toml encoding.Encoding
+}
+
+func newTestEncodings(t *testing.T) testEncodings {
+	jsonEnc, err := json.NewJSONEncoding()
+	require.NoError(t, err)
+	yamlEnc, err := yaml.NewYAMLEncoding()
+	require.NoError(t, err)
+	tomlEnc, err := toml.NewTOMLEncoding()
+	require.NoError(t, err)
+
+	return testEncodings{
+		json: jsonEnc,
+		yaml: yamlEnc,
+		toml: tomlEnc,
+	}
+}
+
+func TestConfiguration_Load_Sources(t *testing.T) {
+	t.Setenv("APP_DATABASE_PORT", "6543")
+
+	enc := newTestEncodings(t)
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/etc/app/config.yaml",
+		[]byte("name: system\ndatabase:\n  host: system.example.com\n  port: 1234\ntags: [system]\n"), 0640))
+	require.NoError(t, afero.WriteFile(fs, "/app.toml",
+		[]byte("name = \"local\"\n"), 0640))
+
+	conf := &TestConfigEnv{}
+	c, err := NewConfiguration(conf,
+		OptionDefaults(&TestConfigEnv{Name: "default", Limits: map[string]int{"default": 1}}),
+		// Sources are configured in a different order than their priority
+		OptionSource("local", aferofile.NewAferoFileStorage(fs, "/app.toml", 0640), enc.toml, 30),
+		OptionSource("system", aferofile.NewAferoFileStorage(fs, "/etc/app/config.yaml", 0640), enc.yaml, 10),
+		OptionSource("user", aferofile.NewAferoFileStorage(fs, "/home/user/.config/app/config.yaml", 0640), enc.yaml, 20,
+			SourceOptional()),
+		OptionEnvPrefix("APP"))
+	require.NoError(t, err)
+
+	require.NoError(t, c.Load())
+	require.EqualValues(t, &TestConfigEnv{
+		Name: "local",
+		Database: TestConfigDatabase{
+			Host: "system.example.com",
+			Port: 6543,
+		},
+		Tags:   []string{"system"},
+		Limits: map[string]int{"default": 1},
+	}, conf)
+
+	// Once the optional source exists, it is applied in between the others
+	require.NoError(t, afero.WriteFile(fs, "/home/user/.config/app/config.yaml",
+		[]byte("name: user\ntags: [user]\n"), 0640))
+	require.NoError(t, c.Load())
+	require.EqualValues(t, "local", conf.Name)
+	require.EqualValues(t, []string{"user"}, conf.Tags)
+}
+
+func TestConfiguration_Load_SourcesWithDefaultStorage(t *testing.T) {
+	enc := newTestEncodings(t)
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/default.json", []byte(`{"name":"default storage","tags":["a"]}`), 0640))
+	require.NoError(t, afero.WriteFile(fs, "/low.json", []byte(`{"name":"low","database":{"host":"low"}}`), 0640))
+	require.NoError(t, afero.WriteFile(fs, "/high.json", []byte(`{"tags":["high"]}`), 0640))
+
+	conf := &TestConfigEnv{}
+	c, err := NewConfiguration(conf,
+		OptionEncoding(enc.json),
+		OptionStorage(aferofile.NewAferoFileStorage(fs, "/default.json", 0640)),
+		OptionSource("low", aferofile.NewAferoFileStorage(fs, "/low.json", 0640), enc.json, -1),
+		OptionSource("high", aferofile.NewAferoFileStorage(fs, "/high.json", 0640), enc.json, 1))
+	require.NoError(t, err)
+
+	require.NoError(t, c.Load())
+	require.EqualValues(t, "default storage", conf.Name)
+	require.EqualValues(t, "low", conf.Database.Host)
+	require.EqualValues(t, []string{"high"}, conf.Tags)
+}
+
+func TestConfiguration_Load_SourceMissing(t *testing.T) {
+	enc := newTestEncodings(t)
+	fs := afero.NewMemMapFs()
+
+	conf := &TestConfigEnv{}
+	c, err := NewConfiguration(conf,
+		OptionSource("system", aferofile.NewAferoFileStorage(fs, "/etc/app/config.yaml", 0640), enc.yaml, 10))
+	require.NoError(t, err)
+
+	err = c.Load()
+	require.Error(t, err)
+	require.ErrorIs(t, err, storage.ErrNotExist)
+	require.Contains(t, err.Error(), "source system:")
+}
+
+func TestConfiguration_Load_SourceNotConfigured(t *testing.T) {
+	enc := newTestEncodings(t)
+
+	// The default storage requires an encoding, even if other sources are configured
+	c, err := NewConfiguration(&TestConfigEnv{},
+		OptionStorage(aferofile.NewAferoFileStorage(afero.NewMemMapFs(), "/config.json", 0640)),
+		OptionSource("system", aferofile.NewAferoFileStorage(afero.NewMemMapFs(), "/config.json", 0640), enc.json, 0))
+	require.NoError(t, err)
+	require.EqualError(t, c.Load(), ErrEncodingNotConfigured.Error())
+}
+
+func TestConfiguration_Save_Sources(t *testing.T) {
+	enc := newTestEncodings(t)
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/etc/app/config.yaml", []byte("name: system\n"), 0640))
+
+	conf := &TestConfigSimple{Test: "saved"}
+	c, err := NewConfiguration(conf,
+		OptionEncoding(enc.json),
+		OptionStorage(aferofile.NewAferoFileStorage(fs, "/default.json", 0640)),
+		OptionSource("system", aferofile.NewAferoFileStorage(fs, "/etc/app/config.yaml", 0640), enc.yaml, 10),
+		OptionSource("local", aferofile.NewAferoFileStorage(fs, "/app.toml", 0640), enc.toml, 30, SourceWritable()))
+	require.NoError(t, err)
+
+	require.NoError(t, c.Save())
+
+	// Only the writable source has been written
+	written, err := afero.ReadFile(fs, "/app.toml")
+	require.NoError(t, err)
+	require.EqualValues(t, "test = \"saved\"\n", string(written))
+
+	exists, err := afero.Exists(fs, "/default.json")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	written, err = afero.ReadFile(fs, "/etc/app/config.yaml")
+	require.NoError(t, err)
+	require.EqualValues(t, "name: system\n", string(written))
+}
+
+func TestConfiguration_Save_SourcesDefaultStorage(t *testing.T) {
+	enc := newTestEncodings(t)
+	fs := afero.NewMemMapFs()
+
+	conf := &TestConfigSimple{Test: "saved"}
+	c, err := NewConfiguration(conf,
+		OptionEncoding(enc.json),
+		OptionStorage(aferofile.NewAferoFileStorage(fs, "/default.json", 0640)),
+		OptionSource("system", aferofile.NewAferoFileStorage(fs, "/etc/app/config.yaml", 0640), enc.yaml, 10))
+	require.NoError(t, err)
+
+	// Without a writable source, the default storage is written
+	require.NoError(t, c.Save())
+	written, err := afero.ReadFile(fs, "/default.json")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"test":"saved"}`, string(written))
+}
+
+func TestConfiguration_Save_NoWritableSource(t *testing.T) {
+	enc := newTestEncodings(t)
+
+	c, err := NewConfiguration(&TestConfigSimple{},
+		OptionSource("system", aferofile.NewAferoFileStorage(afero.NewMemMapFs(), "/config.yaml", 0640), enc.yaml, 10))
+	require.NoError(t, err)
+
+	require.EqualError(t, c.Save(), ErrNoWritableSource.Error())
+}
+
+func TestConfiguration_Watch_Sources(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	enc := newTestEncodings(t)
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/config.json", []byte(`{"test":"initial"}`), 0640))
+
+	// The mock storage does not support watching and will not be observed
+	unwatched := NewMockStorage(ctrl)
+	unwatched.EXPECT().ReadConfig().Return([]byte(`{}`), nil).AnyTimes()
+
+	conf := &TestConfigWatch{}
+	c, err := NewConfiguration(conf,
+		OptionSource("unwatched", unwatched, enc.json, 0),
+		OptionSource("watched", aferofile.NewAferoFileStorage(fs, "/config.json", 0640,
+			aferofile.OptionPollInterval(10*time.Millisecond)), enc.json, 1))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watchResult := make(chan error)
+	go func() {
+		watchResult <- c.Watch(ctx)
+	}()
+
+	// Give the watcher some time to pick up the initial contents
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, afero.WriteFile(fs, "/config.json", []byte(`{"test":"changed"}`), 0640))
+	require.Eventually(t, func() bool {
+		return conf.getTest() == "changed"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.EqualError(t, <-watchResult, context.Canceled.Error())
+}
+
+func TestOptionSource(t *testing.T) {
+	enc := newTestEncodings(t)
+	s := aferofile.NewAferoFileStorage(afero.NewMemMapFs(), "/config.json", 0640)
+
+	testCases := []struct {
+		options  []Option
+		expected error
+	}{
+		{[]Option{OptionSource("", s, enc.json, 0)}, ErrSourceNameEmpty},
+		{[]Option{OptionSource("test", nil, enc.json, 0)}, ErrStorageNotConfigured},
+		{[]Option{OptionSource("test", s, nil, 0)}, ErrEncodingNotConfigured},
+		{[]Option{OptionSource(DefaultSourceName, s, enc.json, 0)}, ErrDuplicateSource},
+		{[]Option{OptionSource("test", s, enc.json, 0), OptionSource("test", s, enc.json, 1)}, ErrDuplicateSource},
+		{[]Option{
+			OptionSource("a", s, enc.json, 0, SourceWritable()),
+			OptionSource("b", s, enc.json, 1, SourceWritable()),
+		}, ErrMultipleWritableSources},
+	}
+
+	for _, testCase := range testCases {
+		c, err := NewConfiguration(&TestConfigSimple{}, testCase.options...)
+		require.ErrorIs(t, err, testCase.expected)
+		require.Nil(t, c)
+	}
+
+	c, err := NewConfiguration(&TestConfigSimple{}, OptionSource("test", s, enc.json, 42,
+		SourceOptional(), SourceWritable()))
+	require.NoError(t, err)
+	require.Len(t, c.sources, 1)
+	require.EqualValues(t, &source{
+		name:     "test",
+		storage:  s,
+		encoding: enc.json,
+		priority: 42,
+		optional: true,
+		writable: true,
+	}, c.sources[0])
+}
+
+func TestConfiguration_Load_MultiDocument(t *testing.T) {
+	enc := newTestEncodings(t)
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/etc/app/config.yaml",
+		[]byte("name: main\ndatabase:\n  host: main\n  port: 5432\n"), 0640))
+	require.NoError(t, afero.WriteFile(fs, "/etc/app/conf.d/10-database.yaml",
+		[]byte("database:\n  host: fragment\n"), 0640))
+	require.NoError(t, afero.WriteFile(fs, "/etc/app/conf.d/20-name.yaml", []byte("name: fragment\n"), 0640))
+
+	conf := &TestConfigEnv{}
+	c, err := NewConfiguration(conf,
+		OptionSource("main", aferofile.NewAferoFileStorage(fs, "/etc/app/config.yaml", 0640), enc.yaml, 0,
+			SourceWritable()),
+		OptionSource("conf.d", aferodir.NewAferoDirStorage(fs, "/etc/app/conf.d", "*.yaml"), enc.yaml, 10,
+			SourceOptional()))
+	require.NoError(t, err)
+	require.NoError(t, c.Load())
+
+	require.EqualValues(t, "fragment", conf.Name)
+	require.EqualValues(t, "fragment", conf.Database.Host)
+	require.EqualValues(t, 5432, conf.Database.Port)
+
+	// Values are attributed to the fragments they were read from
+	origin, ok := c.Provenance("database.host")
+	require.True(t, ok)
+	require.EqualValues(t, Origin{Source: "conf.d", Detail: "/etc/app/conf.d/10-database.yaml"}, origin)
+	origin, ok = c.Provenance("database.port")
+	require.True(t, ok)
+	require.EqualValues(t, Origin{Source: "main", Detail: "/etc/app/config.yaml"}, origin)
+
+	// Errors name the offending fragment
+	require.NoError(t, afero.WriteFile(fs, "/etc/app/conf.d/30-broken.yaml", []byte("name: [\n"), 0640))
+	err = c.Load()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "source conf.d: /etc/app/conf.d/30-broken.yaml: ")
+
+	// Optional directories may be missing
+	require.NoError(t, fs.RemoveAll("/etc/app/conf.d"))
+	require.NoError(t, c.Load())
+}
+
+func TestConfiguration_Save_ReadOnly(t *testing.T) {
+	enc := newTestEncodings(t)
+
+	c, err := NewConfiguration(&TestConfigEnv{},
+		OptionSource("conf.d", aferodir.NewAferoDirStorage(afero.NewMemMapFs(), "/conf.d", "*.yaml"), enc.yaml, 0,
+			SourceWritable()))
+	require.NoError(t, err)
+	require.ErrorIs(t, c.Save(), storage.ErrReadOnly)
+}
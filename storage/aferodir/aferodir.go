@@ -0,0 +1,127 @@
+// Package aferodir provides drop-in directory configuration storage for go-structconf accessed through an afero.Fs
+package aferodir
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/anexia-it/go-structconf/storage"
+)
+
+// DefaultPollInterval defines the interval in which Watch checks the directory for changes,
+// unless configured otherwise using OptionPollInterval
+const DefaultPollInterval = time.Second
+
+var _ storage.Storage = (*aferoDirStorage)(nil)
+var _ storage.MultiDocument = (*aferoDirStorage)(nil)
+var _ storage.Watcher = (*aferoDirStorage)(nil)
+
+// Option defines the function type of afero directory storage options
+type Option func(*aferoDirStorage)
+
+// OptionPollInterval configures the interval in which Watch checks the directory for changes.
+// Watch fails with storage.ErrInvalidPollInterval unless the interval is positive.
+func OptionPollInterval(interval time.Duration) Option {
+	return func(s *aferoDirStorage) {
+		s.pollInterval = interval
+	}
+}
+
+// drop-in directory storage implementation with afero
+type aferoDirStorage struct {
+	fs           afero.Fs
+	path         string
+	pattern      string
+	pollInterval time.Duration
+}
+
+// WriteConfig returns storage.ErrReadOnly, as drop-in directories are managed externally
+func (s *aferoDirStorage) WriteConfig([]byte) error {
+	return storage.ErrReadOnly
+}
+
+// ReadConfig returns storage.ErrMultipleDocuments, the files are read using ReadConfigs
+func (s *aferoDirStorage) ReadConfig() ([]byte, error) {
+	return nil, storage.ErrMultipleDocuments
+}
+
+// ReadConfigs reads all files matching the pattern in lexical order of their names.
+// The documents are named by the paths of the files.
+func (s *aferoDirStorage) ReadConfigs() ([]storage.Document, error) {
+	// Entries are sorted by name
+	entries, err := afero.ReadDir(s.fs, s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	documents := make([]storage.Document, 0, len(entries))
+	for _, entry := range entries {
+		if matches, err := s.matches(entry.Name()); err != nil {
+			return nil, err
+		} else if !matches || entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(s.path, entry.Name())
+		data, err := afero.ReadFile(s.fs, path)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, storage.Document{Name: path, Data: data})
+	}
+
+	return documents, nil
+}
+
+// matches checks if the file with the given name is part of the configuration.
+// Hidden files, like temporary files of editors, are ignored.
+func (s *aferoDirStorage) matches(name string) (bool, error) {
+	if strings.HasPrefix(name, ".") {
+		return false, nil
+	}
+	return filepath.Match(s.pattern, name)
+}
+
+// String returns the pattern of the files, including the path of the directory
+func (s *aferoDirStorage) String() string {
+	return filepath.Join(s.path, s.pattern)
+}
+
+// Watch polls the directory for changes, as afero does not provide change notifications
+func (s *aferoDirStorage) Watch(ctx context.Context) (<-chan struct{}, error) {
+	return storage.Poll(ctx, s.pollInterval, s.ReadConfigs, equalDocuments)
+}
+
+// equalDocuments checks if both lists hold the same documents, treating nil and empty lists alike
+func equalDocuments(a, b []storage.Document) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// NewAferoDirStorage initializes a new drop-in directory configuration storage accessed through
+// an afero.Fs, which reads all files in the directory at path whose names match the pattern,
+// like "*.yaml". The pattern syntax is described at filepath.Match.
+//
+// The storage implements storage.MultiDocument, so the files are decoded separately and applied
+// in lexical order of their names when the configuration is loaded. It is read-only.
+func NewAferoDirStorage(fs afero.Fs, path string, pattern string, options ...Option) storage.Storage {
+	s := &aferoDirStorage{
+		fs:           fs,
+		path:         path,
+		pattern:      pattern,
+		pollInterval: DefaultPollInterval,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
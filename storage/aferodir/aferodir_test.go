@@ -0,0 +1,86 @@
+package aferodir_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/anexia-it/go-structconf/storage"
+	"github.com/anexia-it/go-structconf/storage/aferodir"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAferoDirStorage(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/etc/app/conf.d/20-second.yaml", []byte("second"), 0640))
+	require.NoError(t, afero.WriteFile(fs, "/etc/app/conf.d/10-first.yaml", []byte("first"), 0640))
+	require.NoError(t, afero.WriteFile(fs, "/etc/app/conf.d/30-other.json", []byte("other"), 0640))
+	require.NoError(t, afero.WriteFile(fs, "/etc/app/conf.d/.hidden.yaml", []byte("hidden"), 0640))
+	require.NoError(t, fs.Mkdir("/etc/app/conf.d/40-directory.yaml", 0750))
+
+	s := aferodir.NewAferoDirStorage(fs, "/etc/app/conf.d", "*.yaml")
+	multi, ok := s.(storage.MultiDocument)
+	require.True(t, ok, "Afero directory storage does not implement storage.MultiDocument")
+
+	// Matching files are read in lexical order
+	documents, err := multi.ReadConfigs()
+	require.NoError(t, err)
+	require.EqualValues(t, []storage.Document{
+		{Name: "/etc/app/conf.d/10-first.yaml", Data: []byte("first")},
+		{Name: "/etc/app/conf.d/20-second.yaml", Data: []byte("second")},
+	}, documents)
+
+	// The storage is read-only and only provides multiple documents
+	require.ErrorIs(t, s.WriteConfig([]byte("test")), storage.ErrReadOnly)
+	_, err = s.ReadConfig()
+	require.ErrorIs(t, err, storage.ErrMultipleDocuments)
+
+	require.EqualValues(t, "/etc/app/conf.d/*.yaml", fmt.Sprint(s))
+
+	// Missing directories are reported
+	_, err = aferodir.NewAferoDirStorage(fs, "/nonexistent", "*.yaml").(storage.MultiDocument).ReadConfigs()
+	require.ErrorIs(t, err, storage.ErrNotExist)
+}
+
+func TestAferoDirStorage_Watch(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	s := aferodir.NewAferoDirStorage(fs, "/conf.d", "*.yaml", aferodir.OptionPollInterval(10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A missing directory is treated like an empty one
+	changes, err := s.(storage.Watcher).Watch(ctx)
+	require.NoError(t, err)
+
+	// Changes to files which are not part of the configuration must not be reported
+	require.NoError(t, afero.WriteFile(fs, "/conf.d/other.json", []byte("other"), 0640))
+	select {
+	case <-changes:
+		t.Fatal("Change of unrelated file reported")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Added fragments must be reported
+	require.NoError(t, afero.WriteFile(fs, "/conf.d/10-fragment.yaml", []byte("test"), 0640))
+	select {
+	case _, ok := <-changes:
+		require.True(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Added fragment not reported")
+	}
+
+	// Cancelling the context closes the channel
+	cancel()
+	require.Eventually(t, func() bool {
+		select {
+		case _, ok := <-changes:
+			return !ok
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+}
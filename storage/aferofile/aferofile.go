@@ -2,42 +2,270 @@
 package aferofile
 
 import (
-	"github.com/spf13/afero"
+	"bytes"
+	"context"
+	"errors"
+	"io"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
+
+	"github.com/spf13/afero"
 
 	"github.com/anexia-it/go-structconf/storage"
 )
 
+// DefaultPollInterval defines the interval in which Watch checks the file for changes,
+// unless configured otherwise using OptionPollInterval
+const DefaultPollInterval = time.Second
+
+// lockRetryInterval defines the interval in which acquiring a held lock is retried
+const lockRetryInterval = 10 * time.Millisecond
+
 var _ storage.Storage = (*aferoFileStorage)(nil)
+var _ storage.Watcher = (*aferoFileStorage)(nil)
+var _ storage.Versioned = (*aferoFileStorage)(nil)
+
+// Option defines the function type of afero file storage options
+type Option func(*aferoFileStorage)
+
+// OptionPollInterval configures the interval in which Watch checks the file for changes.
+// Watch fails with storage.ErrInvalidPollInterval unless the interval is positive.
+func OptionPollInterval(interval time.Duration) Option {
+	return func(s *aferoFileStorage) {
+		s.pollInterval = interval
+	}
+}
+
+// OptionAtomicWrite enables atomic writes, for filesystems which support renaming files.
+//
+// The data is written to a temporary file in the same directory, which is synced and renamed over
+// the file afterwards. This ensures the file either holds the previous or the new configuration,
+// even if writing fails half-way. The temporary file is created with the configured mode and,
+// where possible, the owner of the file being replaced.
+func OptionAtomicWrite() Option {
+	return func(s *aferoFileStorage) {
+		s.atomic = true
+	}
+}
+
+// OptionLocking protects reads and writes from concurrent access by other processes.
+//
+// As afero does not provide advisory locks, the lock is held by exclusively creating a lock file
+// next to the file, named like the file with a ".lock" suffix, which is removed again afterwards.
+// If the lock cannot be acquired within the given timeout, storage.ErrLockTimeout is returned.
+// Lock files left behind by crashed processes need to be removed manually.
+func OptionLocking(timeout time.Duration) Option {
+	return func(s *aferoFileStorage) {
+		s.locking = true
+		s.lockTimeout = timeout
+	}
+}
 
 // file-based storage implementation with afero
 type aferoFileStorage struct {
-	fs    afero.Fs
-	path  string
-	mode  os.FileMode
-	mutex sync.Mutex
+	fs           afero.Fs
+	path         string
+	mode         os.FileMode
+	pollInterval time.Duration
+	atomic       bool
+	locking      bool
+	lockTimeout  time.Duration
+	mutex        sync.Mutex
 }
 
 func (s *aferoFileStorage) WriteConfig(data []byte) error {
+	_, err := s.WriteConfigVersion(data, storage.AnyVersion)
+	return err
+}
+
+// WriteConfigVersion writes the file, iff its version still matches the expected version.
+// The version consists of the file's modification time, size and a hash of its contents,
+// see storage.FileVersion.
+// Other processes can only be prevented from changing the file between checking the version and
+// writing if locking is enabled using OptionLocking.
+func (s *aferoFileStorage) WriteConfigVersion(data []byte, expected storage.Version) (storage.Version, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	return afero.WriteFile(s.fs, s.path, data, s.mode)
+	unlock, err := s.lock()
+	if err != nil {
+		return storage.NoVersion, err
+	}
+	defer unlock()
+
+	if expected != storage.AnyVersion {
+		_, current, err := s.read()
+		if err != nil && !errors.Is(err, storage.ErrNotExist) {
+			return storage.NoVersion, err
+		} else if current != expected {
+			return storage.NoVersion, storage.ErrConflict
+		}
+	}
+
+	if s.atomic {
+		err = s.writeAtomic(data)
+	} else {
+		err = afero.WriteFile(s.fs, s.path, data, s.mode)
+	}
+	if err != nil {
+		return storage.NoVersion, err
+	}
+
+	info, err := s.fs.Stat(s.path)
+	if err != nil {
+		return storage.NoVersion, err
+	}
+	return storage.FileVersion(info, data), nil
+}
+
+// writeAtomic writes data to a temporary file and renames it over the file
+func (s *aferoFileStorage) writeAtomic(data []byte) error {
+	dir, base := filepath.Split(s.path)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmpFile, err := afero.TempFile(s.fs, dir, "."+base+".tmp-")
+	if err != nil {
+		return err
+	}
+
+	if err := s.writeTempFile(tmpFile, data); err != nil {
+		tmpFile.Close()
+		s.fs.Remove(tmpFile.Name())
+		return err
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		s.fs.Remove(tmpFile.Name())
+		return err
+	}
+
+	if err := s.fs.Rename(tmpFile.Name(), s.path); err != nil {
+		s.fs.Remove(tmpFile.Name())
+		return err
+	}
+
+	// Persist the rename itself. Not all filesystems support syncing directories,
+	// so failures are ignored.
+	if d, err := s.fs.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
+
+// writeTempFile writes data to the temporary file replacing the file and syncs it
+func (s *aferoFileStorage) writeTempFile(tmpFile afero.File, data []byte) error {
+	if err := s.fs.Chmod(tmpFile.Name(), s.mode); err != nil {
+		return err
+	}
+
+	if info, err := s.fs.Stat(s.path); err == nil {
+		if uid, gid, ok := owner(info); ok {
+			// Only privileged processes may hand files to other users, so failures are ignored
+			_ = s.fs.Chown(tmpFile.Name(), uid, gid)
+		}
+	}
+
+	if _, err := tmpFile.Write(data); err != nil {
+		return err
+	}
+
+	return tmpFile.Sync()
 }
 
 func (s *aferoFileStorage) ReadConfig() ([]byte, error) {
+	data, _, err := s.ReadConfigVersion()
+	return data, err
+}
+
+// ReadConfigVersion reads the file along with its version
+func (s *aferoFileStorage) ReadConfigVersion() ([]byte, storage.Version, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	return afero.ReadFile(s.fs, s.path)
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, storage.NoVersion, err
+	}
+	defer unlock()
+
+	return s.read()
+}
+
+// read reads the file and determines its version
+func (s *aferoFileStorage) read() ([]byte, storage.Version, error) {
+	f, err := s.fs.Open(s.path)
+	if err != nil {
+		return nil, storage.NoVersion, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, storage.NoVersion, err
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, storage.NoVersion, err
+	}
+
+	return data, storage.FileVersion(info, data), nil
+}
+
+// lock acquires the lock file, if locking is enabled
+func (s *aferoFileStorage) lock() (unlock func(), err error) {
+	if !s.locking {
+		return func() {}, nil
+	}
+
+	path := s.path + ".lock"
+	deadline := time.Now().Add(s.lockTimeout)
+	for {
+		f, err := s.fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, s.mode)
+		if err == nil {
+			f.Close()
+			return func() {
+				s.fs.Remove(path)
+			}, nil
+		} else if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil, storage.ErrLockTimeout
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// String returns the path of the file
+func (s *aferoFileStorage) String() string {
+	return s.path
+}
+
+// Watch polls the file for changes, as afero does not provide change notifications
+func (s *aferoFileStorage) Watch(ctx context.Context) (<-chan struct{}, error) {
+	return storage.Poll(ctx, s.pollInterval, s.ReadConfig, bytes.Equal)
 }
 
 // NewAferoFileStorage initializes a new file-based configuration storage accessed through an afero.Fs
-func NewAferoFileStorage(fs afero.Fs, path string, mode os.FileMode) storage.Storage {
-	return &aferoFileStorage{
-		fs:   fs,
-		path: path,
-		mode: mode,
+func NewAferoFileStorage(fs afero.Fs, path string, mode os.FileMode, options ...Option) storage.Storage {
+	s := &aferoFileStorage{
+		fs:           fs,
+		path:         path,
+		mode:         mode,
+		pollInterval: DefaultPollInterval,
+	}
+
+	for _, opt := range options {
+		opt(s)
 	}
+
+	return s
 }
@@ -1,9 +1,15 @@
 package aferofile_test
 
 import (
-	"github.com/spf13/afero"
+	"context"
+	"fmt"
+	"os"
 	"testing"
+	"time"
+
+	"github.com/spf13/afero"
 
+	"github.com/anexia-it/go-structconf/storage"
 	"github.com/anexia-it/go-structconf/storage/aferofile"
 	"github.com/stretchr/testify/require"
 )
@@ -34,3 +40,169 @@ func TestAferoFileStorage(t *testing.T) {
 	require.NoError(t, err)
 	require.EqualValues(t, testContents, inBytes)
 }
+
+func TestAferoFileStorage_AtomicWrite(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/etc/app/config.json", []byte("old contents"), 0644))
+
+	s := aferofile.NewAferoFileStorage(fs, "/etc/app/config.json", 0600, aferofile.OptionAtomicWrite())
+	require.NoError(t, s.WriteConfig([]byte("new contents")))
+
+	inBytes, err := afero.ReadFile(fs, "/etc/app/config.json")
+	require.NoError(t, err)
+	require.EqualValues(t, "new contents", string(inBytes))
+
+	// The configured mode is applied
+	info, err := fs.Stat("/etc/app/config.json")
+	require.NoError(t, err)
+	require.EqualValues(t, os.FileMode(0600), info.Mode().Perm())
+
+	// No temporary files are left behind
+	entries, err := afero.ReadDir(fs, "/etc/app")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// Relative paths are written to the working directory
+	s = aferofile.NewAferoFileStorage(fs, "config.json", 0640, aferofile.OptionAtomicWrite())
+	require.NoError(t, s.WriteConfig([]byte("relative contents")))
+	inBytes, err = s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, "relative contents", string(inBytes))
+}
+
+func TestAferoFileStorage_AtomicWrite_ReadOnly(t *testing.T) {
+	base := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(base, "/config.json", []byte("old contents"), 0640))
+
+	s := aferofile.NewAferoFileStorage(afero.NewReadOnlyFs(base), "/config.json", 0640, aferofile.OptionAtomicWrite())
+	require.Error(t, s.WriteConfig([]byte("new contents")))
+
+	// The file is left untouched
+	inBytes, err := afero.ReadFile(base, "/config.json")
+	require.NoError(t, err)
+	require.EqualValues(t, "old contents", string(inBytes))
+}
+
+func TestAferoFileStorage_Locking(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/config.json", []byte("old contents"), 0640))
+
+	s := aferofile.NewAferoFileStorage(fs, "/config.json", 0640, aferofile.OptionLocking(50*time.Millisecond))
+
+	// While another process holds the lock, neither reads nor writes acquire it
+	require.NoError(t, afero.WriteFile(fs, "/config.json.lock", nil, 0640))
+	_, err := s.ReadConfig()
+	require.ErrorIs(t, err, storage.ErrLockTimeout)
+	require.ErrorIs(t, s.WriteConfig([]byte("new contents")), storage.ErrLockTimeout)
+
+	// Writes wait for the lock to be released
+	time.AfterFunc(20*time.Millisecond, func() {
+		fs.Remove("/config.json.lock")
+	})
+	require.NoError(t, s.WriteConfig([]byte("new contents")))
+
+	inBytes, err := s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, "new contents", string(inBytes))
+
+	// The lock file is removed once the lock is released
+	exists, err := afero.Exists(fs, "/config.json.lock")
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestAferoFileStorage_Watch(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	configPath := "config.txt"
+
+	s := aferofile.NewAferoFileStorage(fs, configPath, 0640, aferofile.OptionPollInterval(10*time.Millisecond))
+	require.NotNil(t, s)
+
+	watcher, ok := s.(storage.Watcher)
+	require.True(t, ok, "Afero file storage does not implement storage.Watcher")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Watching a file that does not exist yet must work
+	changes, err := watcher.Watch(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, changes)
+
+	// No changes, no notification
+	select {
+	case <-changes:
+		t.Fatal("Change reported without file being changed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, s.WriteConfig([]byte("test contents")))
+	select {
+	case _, ok := <-changes:
+		require.True(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Change of config file not reported")
+	}
+
+	// Writing the same contents again is not a change
+	require.NoError(t, s.WriteConfig([]byte("test contents")))
+	select {
+	case <-changes:
+		t.Fatal("Change reported without contents being changed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, fs.Remove(configPath))
+	select {
+	case _, ok := <-changes:
+		require.True(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Removal of config file not reported")
+	}
+
+	// Cancelling the context closes the channel
+	cancel()
+	require.Eventually(t, func() bool {
+		select {
+		case _, ok := <-changes:
+			return !ok
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestAferoFileStorage_Watch_InvalidInterval(t *testing.T) {
+	s := aferofile.NewAferoFileStorage(afero.NewMemMapFs(), "config.txt", 0640, aferofile.OptionPollInterval(0))
+
+	_, err := s.(storage.Watcher).Watch(context.Background())
+	require.ErrorIs(t, err, storage.ErrInvalidPollInterval)
+}
+
+func TestAferoFileStorage_String(t *testing.T) {
+	s := aferofile.NewAferoFileStorage(afero.NewMemMapFs(), "/etc/app/config.json", 0640)
+	require.EqualValues(t, "/etc/app/config.json", fmt.Sprint(s))
+}
+
+func TestAferoFileStorage_Versioned(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	s, ok := aferofile.NewAferoFileStorage(fs, "/config.json", 0640).(storage.Versioned)
+	require.True(t, ok, "Afero file storage does not implement storage.Versioned")
+
+	written, err := s.WriteConfigVersion([]byte("first"), storage.NoVersion)
+	require.NoError(t, err)
+
+	data, version, err := s.ReadConfigVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, "first", string(data))
+	require.EqualValues(t, written, version)
+
+	// Changes by others change the version
+	require.NoError(t, afero.WriteFile(fs, "/config.json", []byte("other"), 0640))
+	_, err = s.WriteConfigVersion([]byte("second"), version)
+	require.ErrorIs(t, err, storage.ErrConflict)
+
+	_, err = s.WriteConfigVersion([]byte("second"), storage.AnyVersion)
+	require.NoError(t, err)
+}
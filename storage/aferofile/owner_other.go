@@ -0,0 +1,10 @@
+//go:build !unix
+
+package aferofile
+
+import "os"
+
+// owner always reports the owner as unavailable, as file ownership is not supported on this platform
+func owner(os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package aferofile
+
+import (
+	"os"
+	"syscall"
+)
+
+// owner returns the user and group owning the file described by info, if available
+func owner(info os.FileInfo) (uid, gid int, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
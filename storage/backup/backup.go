@@ -0,0 +1,218 @@
+// Package backup provides a storage decorator for go-structconf, which keeps the previous
+// contents of a storage before they are overwritten
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/spf13/afero"
+
+	"github.com/anexia-it/go-structconf/storage"
+	"github.com/anexia-it/go-structconf/storage/aferofile"
+	"github.com/anexia-it/go-structconf/storage/file"
+)
+
+// DefaultRetention defines the number of backups kept, unless configured otherwise using
+// OptionRetention
+const DefaultRetention = 5
+
+// ErrInvalidBackup indicates that a backup number outside of the retention range was passed
+var ErrInvalidBackup = errors.New("Invalid backup number")
+
+var _ storage.Storage = (*Storage)(nil)
+var _ storage.Watcher = (*Storage)(nil)
+var _ storage.Versioned = (*Storage)(nil)
+
+// Slots defines the function type returning the storage of the n-th backup, starting with 1 for
+// the most recent backup
+type Slots func(n int) storage.Storage
+
+// FileSlots returns slots storing backups in files named like the file at path with the backup
+// number as suffix, like config.yaml.1
+func FileSlots(path string, mode os.FileMode, options ...file.Option) Slots {
+	return func(n int) storage.Storage {
+		return file.NewFileStorage(fmt.Sprintf("%s.%d", path, n), mode, options...)
+	}
+}
+
+// AferoFileSlots returns slots storing backups in files accessed through an afero.Fs,
+// named like the file at path with the backup number as suffix, like config.yaml.1
+func AferoFileSlots(fs afero.Fs, path string, mode os.FileMode, options ...aferofile.Option) Slots {
+	return func(n int) storage.Storage {
+		return aferofile.NewAferoFileStorage(fs, fmt.Sprintf("%s.%d", path, n), mode, options...)
+	}
+}
+
+// Option defines the function type of backup storage options
+type Option func(*Storage)
+
+// OptionRetention configures the number of backups kept
+func OptionRetention(retention int) Option {
+	return func(s *Storage) {
+		s.retention = retention
+	}
+}
+
+// Storage wraps a storage and keeps the previous contents every time the configuration is written.
+//
+// Before the configuration is replaced, the existing backups are rotated, so backup 1 always holds
+// the most recently replaced configuration. Backups exceeding the retention count are overwritten.
+// Writes not changing the stored configuration do not create a backup.
+type Storage struct {
+	storage   storage.Storage
+	slots     Slots
+	retention int
+	mutex     sync.Mutex
+}
+
+// WriteConfig backs up the stored configuration and writes the new configuration
+func (s *Storage) WriteConfig(data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	current, err := s.storage.ReadConfig()
+	if err != nil && !errors.Is(err, storage.ErrNotExist) {
+		return err
+	} else if err == nil && !bytes.Equal(current, data) {
+		if err := s.rotate(current); err != nil {
+			return err
+		}
+	}
+
+	return s.storage.WriteConfig(data)
+}
+
+// ReadConfig reads the configuration from the wrapped storage
+func (s *Storage) ReadConfig() ([]byte, error) {
+	return s.storage.ReadConfig()
+}
+
+// ReadConfigVersion reads the configuration along with its version from the wrapped storage.
+// If the wrapped storage does not implement storage.Versioned, storage.ErrVersionNotSupported
+// is returned.
+func (s *Storage) ReadConfigVersion() ([]byte, storage.Version, error) {
+	versioned, ok := s.storage.(storage.Versioned)
+	if !ok {
+		return nil, storage.NoVersion, storage.ErrVersionNotSupported
+	}
+	return versioned.ReadConfigVersion()
+}
+
+// WriteConfigVersion backs up the stored configuration and writes the new configuration, iff the
+// version of the stored configuration matches the expected version.
+// If the wrapped storage does not implement storage.Versioned, storage.ErrVersionNotSupported
+// is returned.
+func (s *Storage) WriteConfigVersion(data []byte, expected storage.Version) (storage.Version, error) {
+	versioned, ok := s.storage.(storage.Versioned)
+	if !ok {
+		return storage.NoVersion, storage.ErrVersionNotSupported
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	current, version, err := versioned.ReadConfigVersion()
+	if err != nil && !errors.Is(err, storage.ErrNotExist) {
+		return storage.NoVersion, err
+	}
+
+	// Check the version upfront, so conflicting writes do not rotate the backups
+	if expected != storage.AnyVersion && expected != version {
+		return storage.NoVersion, storage.ErrConflict
+	}
+
+	if err == nil && !bytes.Equal(current, data) {
+		if err := s.rotate(current); err != nil {
+			return storage.NoVersion, err
+		}
+	}
+
+	return versioned.WriteConfigVersion(data, expected)
+}
+
+// Watch observes the wrapped storage.
+// If the wrapped storage does not implement storage.Watcher, storage.ErrWatchNotSupported
+// is returned.
+func (s *Storage) Watch(ctx context.Context) (<-chan struct{}, error) {
+	watcher, ok := s.storage.(storage.Watcher)
+	if !ok {
+		return nil, storage.ErrWatchNotSupported
+	}
+	return watcher.Watch(ctx)
+}
+
+// String returns the description of the wrapped storage, if it implements fmt.Stringer
+func (s *Storage) String() string {
+	if stringer, ok := s.storage.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return ""
+}
+
+// rotate moves every backup to the next slot and stores data as backup 1
+func (s *Storage) rotate(data []byte) error {
+	if s.retention < 1 {
+		return nil
+	}
+
+	for n := s.retention - 1; n >= 1; n-- {
+		backup, err := s.slots(n).ReadConfig()
+		if errors.Is(err, storage.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("backup %d: %w", n, err)
+		}
+
+		if err := s.slots(n + 1).WriteConfig(backup); err != nil {
+			return fmt.Errorf("backup %d: %w", n+1, err)
+		}
+	}
+
+	if err := s.slots(1).WriteConfig(data); err != nil {
+		return fmt.Errorf("backup 1: %w", err)
+	}
+	return nil
+}
+
+// Backup returns the contents of the n-th backup, starting with 1 for the most recent backup
+func (s *Storage) Backup(n int) ([]byte, error) {
+	if n < 1 || n > s.retention {
+		return nil, ErrInvalidBackup
+	}
+
+	return s.slots(n).ReadConfig()
+}
+
+// Restore rolls the configuration back to the n-th backup, starting with 1 for the most
+// recent backup.
+//
+// The configuration being replaced is backed up like on every other write, which shifts the
+// existing backups by one. Restore(1) can therefore be used to undo a previous Restore(1).
+func (s *Storage) Restore(n int) error {
+	data, err := s.Backup(n)
+	if err != nil {
+		return err
+	}
+
+	return s.WriteConfig(data)
+}
+
+// NewBackupStorage wraps the passed storage, keeping backups in the passed slots
+func NewBackupStorage(s storage.Storage, slots Slots, options ...Option) *Storage {
+	backupStorage := &Storage{
+		storage:   s,
+		slots:     slots,
+		retention: DefaultRetention,
+	}
+
+	for _, opt := range options {
+		opt(backupStorage)
+	}
+
+	return backupStorage
+}
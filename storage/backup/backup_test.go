@@ -0,0 +1,121 @@
+package backup_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"github.com/anexia-it/go-structconf/storage"
+	"github.com/anexia-it/go-structconf/storage/aferofile"
+	"github.com/anexia-it/go-structconf/storage/backup"
+	"github.com/stretchr/testify/require"
+)
+
+// requireFile checks the contents of the file at path
+func requireFile(t *testing.T, fs afero.Fs, path string, expected string) {
+	inBytes, err := afero.ReadFile(fs, path)
+	require.NoError(t, err)
+	require.EqualValues(t, expected, string(inBytes))
+}
+
+func TestBackupStorage(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	s := backup.NewBackupStorage(aferofile.NewAferoFileStorage(fs, "/config.yaml", 0640),
+		backup.AferoFileSlots(fs, "/config.yaml", 0640), backup.OptionRetention(2))
+
+	// Nothing is backed up if no configuration is stored
+	require.NoError(t, s.WriteConfig([]byte("first")))
+	exists, err := afero.Exists(fs, "/config.yaml.1")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// Previous contents are rotated
+	require.NoError(t, s.WriteConfig([]byte("second")))
+	require.NoError(t, s.WriteConfig([]byte("third")))
+	require.NoError(t, s.WriteConfig([]byte("fourth")))
+	requireFile(t, fs, "/config.yaml", "fourth")
+	requireFile(t, fs, "/config.yaml.1", "third")
+	requireFile(t, fs, "/config.yaml.2", "second")
+
+	// Backups exceeding the retention count are not kept
+	exists, err = afero.Exists(fs, "/config.yaml.3")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// Writing unchanged contents does not create a backup
+	require.NoError(t, s.WriteConfig([]byte("fourth")))
+	requireFile(t, fs, "/config.yaml.1", "third")
+
+	data, err := s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, "fourth", string(data))
+
+	require.EqualValues(t, "/config.yaml", fmt.Sprint(s))
+}
+
+func TestBackupStorage_Restore(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	s := backup.NewBackupStorage(aferofile.NewAferoFileStorage(fs, "/config.yaml", 0640),
+		backup.AferoFileSlots(fs, "/config.yaml", 0640))
+
+	for _, contents := range []string{"first", "second", "third"} {
+		require.NoError(t, s.WriteConfig([]byte(contents)))
+	}
+
+	require.ErrorIs(t, s.Restore(0), backup.ErrInvalidBackup)
+	require.ErrorIs(t, s.Restore(backup.DefaultRetention+1), backup.ErrInvalidBackup)
+	require.ErrorIs(t, s.Restore(3), storage.ErrNotExist)
+
+	// The replaced configuration is backed up as well
+	require.NoError(t, s.Restore(2))
+	requireFile(t, fs, "/config.yaml", "first")
+	requireFile(t, fs, "/config.yaml.1", "third")
+
+	require.NoError(t, s.Restore(1))
+	requireFile(t, fs, "/config.yaml", "third")
+
+	data, err := s.Backup(1)
+	require.NoError(t, err)
+	require.EqualValues(t, "first", string(data))
+}
+
+func TestBackupStorage_Versioned(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	s := backup.NewBackupStorage(aferofile.NewAferoFileStorage(fs, "/config.yaml", 0640),
+		backup.AferoFileSlots(fs, "/config.yaml", 0640))
+
+	version, err := s.WriteConfigVersion([]byte("first"), storage.NoVersion)
+	require.NoError(t, err)
+
+	// Conflicting writes neither write nor rotate
+	_, err = s.WriteConfigVersion([]byte("second"), storage.NoVersion)
+	require.ErrorIs(t, err, storage.ErrConflict)
+	_, err = s.Backup(1)
+	require.ErrorIs(t, err, storage.ErrNotExist)
+
+	_, err = s.WriteConfigVersion([]byte("second"), version)
+	require.NoError(t, err)
+	requireFile(t, fs, "/config.yaml.1", "first")
+}
+
+// plainStorage hides all optional interfaces of the wrapped storage
+type plainStorage struct {
+	storage.Storage
+}
+
+func TestBackupStorage_Unsupported(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	s := backup.NewBackupStorage(plainStorage{aferofile.NewAferoFileStorage(fs, "/config.yaml", 0640)},
+		backup.AferoFileSlots(fs, "/config.yaml", 0640))
+
+	_, _, err := s.ReadConfigVersion()
+	require.ErrorIs(t, err, storage.ErrVersionNotSupported)
+	_, err = s.WriteConfigVersion([]byte("test"), storage.AnyVersion)
+	require.ErrorIs(t, err, storage.ErrVersionNotSupported)
+
+	changes, err := s.Watch(context.Background())
+	require.ErrorIs(t, err, storage.ErrWatchNotSupported)
+	require.Nil(t, changes)
+}
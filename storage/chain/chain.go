@@ -0,0 +1,270 @@
+// Package chain provides a storage decorator for go-structconf, which falls back to further
+// storages if reading the configuration fails
+package chain
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/anexia-it/go-structconf/storage"
+)
+
+var _ storage.Storage = (*Storage)(nil)
+var _ storage.Watcher = (*Storage)(nil)
+var _ storage.Versioned = (*Storage)(nil)
+
+// Option defines the function type of chain storage options
+type Option func(*Storage)
+
+// OptionCache configures a storage which is refreshed with the configuration every time it was
+// written to or read from the primary storage, like a local file the chain falls back to if a
+// remote primary storage is unavailable.
+//
+// Refreshing the cache is best-effort, failures are ignored. The cache is only written if its
+// contents differ.
+func OptionCache(cache storage.Storage) Option {
+	return func(s *Storage) {
+		s.cache = cache
+	}
+}
+
+// Storage wraps an ordered list of storages, the first one being the primary storage.
+//
+// Reads return the configuration of the first storage which succeeds, the storage which served
+// the read is recorded, see Served. If all storages fail, their errors are aggregated.
+// Writes only go to the primary storage.
+type Storage struct {
+	storages []storage.Storage
+	cache    storage.Storage
+	served   storage.Storage
+	mutex    sync.Mutex
+}
+
+// WriteConfig writes the configuration to the primary storage and refreshes the cache,
+// if configured
+func (s *Storage) WriteConfig(data []byte) error {
+	primary, err := s.primary()
+	if err != nil {
+		return err
+	}
+
+	if err := primary.WriteConfig(data); err != nil {
+		return err
+	}
+
+	s.refreshCache(data)
+	return nil
+}
+
+// ReadConfig reads the configuration from the first storage which succeeds.
+// If all storages fail, a *multierror.Error holding the errors of all storages is returned.
+func (s *Storage) ReadConfig() ([]byte, error) {
+	data, _, err := s.read(false)
+	return data, err
+}
+
+// ReadConfigVersion reads the configuration like ReadConfig, along with its version.
+//
+// Only versions of the primary storage are reported, as the versions of different storages cannot
+// be compared. If the configuration was served by another storage, the reported version expects
+// the primary storage's configuration not to exist, if it reported so, and otherwise is
+// storage.UnknownVersion, which fails every conditional write with storage.ErrConflict. This prevents a configuration loaded from a stale
+// fallback from silently replacing the primary storage's configuration, unless saving is forced.
+// If the primary storage does not implement storage.Versioned, storage.ErrVersionNotSupported is
+// returned.
+func (s *Storage) ReadConfigVersion() ([]byte, storage.Version, error) {
+	primary, err := s.primary()
+	if err != nil {
+		return nil, storage.NoVersion, err
+	} else if _, ok := primary.(storage.Versioned); !ok {
+		return nil, storage.NoVersion, storage.ErrVersionNotSupported
+	}
+
+	return s.read(true)
+}
+
+// WriteConfigVersion writes the configuration to the primary storage like WriteConfig, iff the
+// version of its stored configuration matches the expected version.
+// If the primary storage does not implement storage.Versioned, storage.ErrVersionNotSupported
+// is returned.
+func (s *Storage) WriteConfigVersion(data []byte, expected storage.Version) (storage.Version, error) {
+	primary, err := s.primary()
+	if err != nil {
+		return storage.NoVersion, err
+	}
+
+	versioned, ok := primary.(storage.Versioned)
+	if !ok {
+		return storage.NoVersion, storage.ErrVersionNotSupported
+	} else if expected == storage.UnknownVersion {
+		// Primary storages parsing versions, like revisions, would fail instead of reporting a conflict
+		return storage.NoVersion, storage.ErrConflict
+	}
+
+	version, err := versioned.WriteConfigVersion(data, expected)
+	if err != nil {
+		return version, err
+	}
+
+	s.refreshCache(data)
+	return version, nil
+}
+
+// read reads the configuration from the first storage which succeeds.
+// If versioned is set, the version of the primary storage is read.
+func (s *Storage) read(versioned bool) ([]byte, storage.Version, error) {
+	var result error
+	primaryVersion := storage.UnknownVersion
+	for i, member := range s.storages {
+		var data []byte
+		version := primaryVersion
+		var err error
+		if i == 0 && versioned {
+			data, version, err = member.(storage.Versioned).ReadConfigVersion()
+			if errors.Is(err, storage.ErrNotExist) {
+				primaryVersion = storage.NoVersion
+			}
+		} else {
+			data, err = member.ReadConfig()
+		}
+
+		if err != nil {
+			result = multierror.Append(result, multierror.Prefix(err, describe(i, member)+":"))
+			continue
+		}
+
+		s.mutex.Lock()
+		s.served = member
+		s.mutex.Unlock()
+
+		if i == 0 {
+			s.refreshCache(data)
+		}
+		return data, version, nil
+	}
+
+	if result == nil {
+		return nil, storage.NoVersion, storage.ErrNotExist
+	}
+	return nil, storage.NoVersion, result
+}
+
+// refreshCache writes data to the cache, if configured and its contents differ
+func (s *Storage) refreshCache(data []byte) {
+	if s.cache == nil {
+		return
+	}
+
+	if cached, err := s.cache.ReadConfig(); err == nil && bytes.Equal(cached, data) {
+		return
+	}
+	_ = s.cache.WriteConfig(data)
+}
+
+// primary returns the primary storage.
+// Chains without storages are read-only.
+func (s *Storage) primary() (storage.Storage, error) {
+	if len(s.storages) == 0 {
+		return nil, storage.ErrReadOnly
+	}
+	return s.storages[0], nil
+}
+
+// Served returns the storage which served the last successful read, or nil if no read
+// succeeded yet
+func (s *Storage) Served() storage.Storage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.served
+}
+
+// Watch observes all storages implementing storage.Watcher, coalescing their changes.
+// If none of the storages supports watching, storage.ErrWatchNotSupported is returned.
+func (s *Storage) Watch(ctx context.Context) (<-chan struct{}, error) {
+	watchCtx, cancel := context.WithCancel(ctx)
+
+	changes := make(chan struct{}, 1)
+	var wg sync.WaitGroup
+	watched := 0
+
+	for i, member := range s.storages {
+		watcher, ok := member.(storage.Watcher)
+		if !ok {
+			continue
+		}
+
+		memberChanges, err := watcher.Watch(watchCtx)
+		if errors.Is(err, storage.ErrWatchNotSupported) {
+			continue
+		} else if err != nil {
+			cancel()
+			return nil, fmt.Errorf("%s: %w", describe(i, member), err)
+		}
+		watched++
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range memberChanges {
+				storage.Notify(changes)
+			}
+		}()
+	}
+
+	if watched == 0 {
+		cancel()
+		return nil, storage.ErrWatchNotSupported
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		close(changes)
+	}()
+
+	return changes, nil
+}
+
+// String returns the description of the storage which served the last successful read, or of the
+// primary storage if no read succeeded yet, if it implements fmt.Stringer
+func (s *Storage) String() string {
+	member := s.Served()
+	if member == nil && len(s.storages) > 0 {
+		member = s.storages[0]
+	}
+
+	if stringer, ok := member.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return ""
+}
+
+// describe returns the description of the i-th storage used in errors
+func describe(i int, member storage.Storage) string {
+	if stringer, ok := member.(fmt.Stringer); ok {
+		if description := stringer.String(); description != "" {
+			return fmt.Sprintf("storage %d (%s)", i+1, description)
+		}
+	}
+	return fmt.Sprintf("storage %d", i+1)
+}
+
+// NewChainStorage wraps the passed storages, which are read in the given order.
+// The first storage is the primary storage, which the configuration is written to.
+func NewChainStorage(storages []storage.Storage, options ...Option) *Storage {
+	s := &Storage{
+		storages: storages,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
@@ -0,0 +1,169 @@
+package chain_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/anexia-it/go-structconf/storage"
+	"github.com/anexia-it/go-structconf/storage/chain"
+	"github.com/anexia-it/go-structconf/storage/fsys"
+	"github.com/anexia-it/go-structconf/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+func TestChainStorage(t *testing.T) {
+	remote := memory.NewMemoryStorage(memory.OptionData([]byte(`{"test":"remote"}`)))
+	cache := memory.NewMemoryStorage()
+	defaults := fsys.NewFSStorage(fstest.MapFS{
+		"config.json": {Data: []byte(`{"test":"default"}`)},
+	}, "config.json")
+	s := chain.NewChainStorage([]storage.Storage{remote, cache, defaults}, chain.OptionCache(cache))
+	require.Nil(t, s.Served())
+
+	// Reads are served by the primary storage and refresh the cache
+	inBytes, err := s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"remote"}`, string(inBytes))
+	require.Equal(t, remote, s.Served())
+	cached, _ := cache.Data()
+	require.EqualValues(t, `{"test":"remote"}`, string(cached))
+
+	// Unchanged configurations are not written to the cache again
+	_, err = s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, 1, cache.Writes())
+
+	// Failing storages are skipped
+	remote.FailNextRead(errUnavailable)
+	inBytes, err = s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"remote"}`, string(inBytes))
+	require.Equal(t, cache, s.Served())
+
+	remote.FailNextRead(errUnavailable)
+	cache.FailNextRead(storage.ErrNotExist)
+	inBytes, err = s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"default"}`, string(inBytes))
+	require.Equal(t, defaults, s.Served())
+	require.EqualValues(t, "config.json", fmt.Sprint(s))
+
+	// Writes go to the primary storage and refresh the cache
+	require.NoError(t, s.WriteConfig([]byte(`{"test":"written"}`)))
+	written, _ := remote.Data()
+	require.EqualValues(t, `{"test":"written"}`, string(written))
+	cached, _ = cache.Data()
+	require.EqualValues(t, `{"test":"written"}`, string(cached))
+
+	// Failing writes do not touch the cache
+	remote.FailNextWrite(errUnavailable)
+	require.ErrorIs(t, s.WriteConfig([]byte(`{"test":"failed"}`)), errUnavailable)
+	cached, _ = cache.Data()
+	require.EqualValues(t, `{"test":"written"}`, string(cached))
+}
+
+func TestChainStorage_Errors(t *testing.T) {
+	primary := memory.NewMemoryStorage()
+	secondary := memory.NewMemoryStorage()
+	s := chain.NewChainStorage([]storage.Storage{primary, secondary})
+
+	// Errors of all storages are aggregated
+	primary.FailNextRead(errUnavailable)
+	_, err := s.ReadConfig()
+	require.ErrorIs(t, err, errUnavailable)
+	require.ErrorIs(t, err, storage.ErrNotExist)
+
+	multiErr, ok := err.(*multierror.Error)
+	require.True(t, ok, "Returned error is not a multierror.Error")
+	require.Len(t, multiErr.Errors, 2)
+	require.Contains(t, multiErr.Errors[0].Error(), "storage 1 (memory): ")
+	require.Contains(t, multiErr.Errors[1].Error(), "storage 2 (memory): ")
+	require.Nil(t, s.Served())
+
+	// Chains without storages have no configuration
+	empty := chain.NewChainStorage(nil)
+	_, err = empty.ReadConfig()
+	require.ErrorIs(t, err, storage.ErrNotExist)
+	require.ErrorIs(t, empty.WriteConfig([]byte(`{}`)), storage.ErrReadOnly)
+}
+
+func TestChainStorage_Version(t *testing.T) {
+	primary := memory.NewMemoryStorage(memory.OptionData([]byte(`{"test":"primary"}`)))
+	secondary := memory.NewMemoryStorage(memory.OptionData([]byte(`{"test":"secondary"}`)))
+	s := chain.NewChainStorage([]storage.Storage{primary, secondary})
+
+	_, version, err := s.ReadConfigVersion()
+	require.NoError(t, err)
+	_, expected, err := primary.ReadConfigVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, expected, version)
+
+	// Configurations served by other storages must not replace the primary storage's configuration
+	primary.FailNextRead(errUnavailable)
+	inBytes, version, err := s.ReadConfigVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"secondary"}`, string(inBytes))
+	require.EqualValues(t, storage.UnknownVersion, version)
+	_, err = s.WriteConfigVersion([]byte(`{"test":"stale"}`), version)
+	require.ErrorIs(t, err, storage.ErrConflict)
+	written, _ := primary.Data()
+	require.EqualValues(t, `{"test":"primary"}`, string(written))
+
+	_, err = s.WriteConfigVersion([]byte(`{"test":"written"}`), expected)
+	require.NoError(t, err)
+	_, err = s.WriteConfigVersion([]byte(`{"test":"conflict"}`), expected)
+	require.ErrorIs(t, err, storage.ErrConflict)
+
+	// Unless the primary storage reported that its configuration does not exist
+	empty := memory.NewMemoryStorage()
+	s = chain.NewChainStorage([]storage.Storage{empty, secondary})
+	inBytes, version, err = s.ReadConfigVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"secondary"}`, string(inBytes))
+	require.EqualValues(t, storage.NoVersion, version)
+	_, err = s.WriteConfigVersion([]byte(`{"test":"written"}`), version)
+	require.NoError(t, err)
+
+	// Primary storages without version support are reported as such
+	s = chain.NewChainStorage([]storage.Storage{fsys.NewFSStorage(fstest.MapFS{}, "config.json"), secondary})
+	_, _, err = s.ReadConfigVersion()
+	require.ErrorIs(t, err, storage.ErrVersionNotSupported)
+	_, err = s.WriteConfigVersion([]byte(`{}`), storage.AnyVersion)
+	require.ErrorIs(t, err, storage.ErrVersionNotSupported)
+}
+
+func TestChainStorage_Watch(t *testing.T) {
+	primary := memory.NewMemoryStorage()
+	secondary := memory.NewMemoryStorage()
+	s := chain.NewChainStorage([]storage.Storage{primary, secondary})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := s.Watch(ctx)
+	require.NoError(t, err)
+
+	// Changes of all storages are reported
+	for _, member := range []*memory.Storage{primary, secondary} {
+		member.Set([]byte(`{"test":"changed"}`))
+		select {
+		case <-changes:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no change notification")
+		}
+	}
+
+	cancel()
+	for range changes {
+	}
+
+	s = chain.NewChainStorage([]storage.Storage{fsys.NewFSStorage(fstest.MapFS{}, "config.json")})
+	_, err = s.Watch(context.Background())
+	require.ErrorIs(t, err, storage.ErrWatchNotSupported)
+}
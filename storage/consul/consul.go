@@ -0,0 +1,339 @@
+// Package consul provides configuration storage for go-structconf backed by the Consul KV store
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/anexia-it/go-structconf"
+	"github.com/anexia-it/go-structconf/encoding"
+	"github.com/anexia-it/go-structconf/storage"
+)
+
+// DefaultWaitTime defines how long blocking queries used by Watch wait for changes,
+// unless configured otherwise using OptionWaitTime
+const DefaultWaitTime = 5 * time.Minute
+
+// watchRetryInterval defines the delay before a failed blocking query is retried
+const watchRetryInterval = time.Second
+
+// maxTxnOps defines the maximum number of operations Consul accepts in a transaction
+const maxTxnOps = 64
+
+// casFailure is part of the error Consul reports for check-and-set operations whose index did not
+// match the entry's ModifyIndex
+const casFailure = "index is stale"
+
+// ErrTooManyEntries indicates that a configuration written in tree mode consists of more leaf
+// values than fit into a single Consul transaction
+var ErrTooManyEntries = errors.New("Configuration exceeds the operations of a Consul transaction")
+
+var _ storage.Storage = (*consulStorage)(nil)
+var _ storage.Watcher = (*consulStorage)(nil)
+var _ storage.Versioned = (*consulStorage)(nil)
+
+// Option defines the function type of Consul storage options
+type Option func(*consulStorage)
+
+// OptionWaitTime configures how long blocking queries used by Watch wait for changes
+func OptionWaitTime(waitTime time.Duration) Option {
+	return func(s *consulStorage) {
+		s.waitTime = waitTime
+	}
+}
+
+// OptionTree stores every leaf value of the configuration as a separate entry below the key,
+// instead of storing the encoded configuration as a single entry.
+//
+// The path of each value is appended to the key, separated by slashes, and the value is stored
+// JSON-encoded. The passed encoding needs to match the encoding the storage is used with, as the
+// configuration is decoded for writing and encoded again after reading.
+// All entries are written in a single transaction, which is limited to 64 operations by Consul,
+// one of which removes the previous entries. Writing more leaf values fails with ErrTooManyEntries.
+// Versions are not supported in tree mode.
+func OptionTree(enc encoding.Encoding) Option {
+	return func(s *consulStorage) {
+		s.tree = enc
+	}
+}
+
+// Consul KV-based storage implementation
+type consulStorage struct {
+	kv       *api.KV
+	key      string
+	waitTime time.Duration
+	tree     encoding.Encoding
+}
+
+func (s *consulStorage) WriteConfig(data []byte) error {
+	if s.tree != nil {
+		return s.writeTree(data)
+	}
+
+	_, err := s.WriteConfigVersion(data, storage.AnyVersion)
+	return err
+}
+
+func (s *consulStorage) ReadConfig() ([]byte, error) {
+	if s.tree != nil {
+		return s.readTree()
+	}
+
+	data, _, err := s.ReadConfigVersion()
+	return data, err
+}
+
+// ReadConfigVersion reads the entry, using its ModifyIndex as version.
+// In tree mode, storage.ErrVersionNotSupported is returned.
+func (s *consulStorage) ReadConfigVersion() ([]byte, storage.Version, error) {
+	if s.tree != nil {
+		return nil, storage.NoVersion, storage.ErrVersionNotSupported
+	}
+
+	pair, _, err := s.kv.Get(s.key, nil)
+	if err != nil {
+		return nil, storage.NoVersion, err
+	} else if pair == nil {
+		return nil, storage.NoVersion, fmt.Errorf("key %s: %w", s.key, storage.ErrNotExist)
+	}
+
+	return pair.Value, indexVersion(pair.ModifyIndex), nil
+}
+
+// WriteConfigVersion writes the entry using a check-and-set operation, which compares the
+// entry's ModifyIndex with the expected version.
+// In tree mode, storage.ErrVersionNotSupported is returned.
+func (s *consulStorage) WriteConfigVersion(data []byte, expected storage.Version) (storage.Version, error) {
+	if s.tree != nil {
+		return storage.NoVersion, storage.ErrVersionNotSupported
+	}
+
+	write := &api.KVTxnOp{Verb: api.KVSet, Key: s.key, Value: data}
+	if expected != storage.AnyVersion {
+		// A check-and-set operation with index 0 only succeeds if the entry does not exist
+		var index uint64
+		if expected != storage.NoVersion {
+			var err error
+			if index, err = strconv.ParseUint(string(expected), 10, 64); err != nil {
+				return storage.NoVersion, fmt.Errorf("invalid version %q: %w", expected, err)
+			}
+		}
+		write.Verb = api.KVCAS
+		write.Index = index
+	}
+
+	// Read the entry within the same transaction, to determine its new ModifyIndex
+	ok, resp, _, err := s.kv.Txn(api.KVTxnOps{write, {Verb: api.KVGet, Key: s.key}}, nil)
+	if err != nil {
+		return storage.NoVersion, err
+	} else if !ok && write.Verb == api.KVCAS && casFailed(resp) {
+		return storage.NoVersion, storage.ErrConflict
+	} else if !ok {
+		return storage.NoVersion, fmt.Errorf("key %s: transaction failed: %s", s.key, txnErrors(resp))
+	} else if len(resp.Results) != 2 || resp.Results[1] == nil {
+		return storage.NoVersion, fmt.Errorf("key %s: unexpected transaction result", s.key)
+	}
+
+	return indexVersion(resp.Results[1].ModifyIndex), nil
+}
+
+// Watch observes the entry, or all entries below the key in tree mode, using blocking queries
+func (s *consulStorage) Watch(ctx context.Context) (<-chan struct{}, error) {
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+
+		var index uint64
+		initial := true
+		failing := false
+
+		for {
+			opts := (&api.QueryOptions{WaitIndex: index, WaitTime: s.waitTime}).WithContext(ctx)
+			lastIndex, err := s.query(opts)
+			if ctx.Err() != nil {
+				return
+			} else if err != nil {
+				// Report the first failure only, the consumer runs into the error on its next read
+				if !failing {
+					failing = true
+					storage.Notify(changes)
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(watchRetryInterval):
+				}
+				continue
+			}
+
+			if failing || (!initial && lastIndex != index) {
+				storage.Notify(changes)
+			}
+			failing = false
+			initial = false
+
+			// The index may go backwards, for example after a snapshot was restored
+			index = lastIndex
+		}
+	}()
+
+	return changes, nil
+}
+
+// String returns the key
+func (s *consulStorage) String() string {
+	return s.key
+}
+
+// query performs a blocking query for the entry, or all entries below the key in tree mode,
+// and returns the resulting index
+func (s *consulStorage) query(opts *api.QueryOptions) (uint64, error) {
+	var meta *api.QueryMeta
+	var err error
+	if s.tree != nil {
+		_, meta, err = s.kv.List(s.prefix(), opts)
+	} else {
+		_, meta, err = s.kv.Get(s.key, opts)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+	return meta.LastIndex, nil
+}
+
+// prefix returns the prefix of all entries in tree mode
+func (s *consulStorage) prefix() string {
+	return strings.TrimSuffix(s.key, "/") + "/"
+}
+
+// writeTree replaces all entries below the key with the leaf values of the configuration
+func (s *consulStorage) writeTree(data []byte) error {
+	m := make(map[string]interface{})
+	if err := s.tree.UnmarshalTo(data, m); err != nil {
+		return err
+	}
+
+	ops := api.KVTxnOps{{Verb: api.KVDeleteTree, Key: s.prefix()}}
+	if err := flatten(s.prefix(), m, func(key string, value []byte) {
+		ops = append(ops, &api.KVTxnOp{Verb: api.KVSet, Key: key, Value: value})
+	}); err != nil {
+		return err
+	}
+	if len(ops) > maxTxnOps {
+		return fmt.Errorf("key %s: %d values: %w", s.key, len(ops)-1, ErrTooManyEntries)
+	}
+
+	ok, resp, _, err := s.kv.Txn(ops, nil)
+	if err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("key %s: transaction failed: %s", s.key, txnErrors(resp))
+	}
+	return nil
+}
+
+// readTree reads all entries below the key and encodes the resulting configuration
+func (s *consulStorage) readTree() ([]byte, error) {
+	pairs, _, err := s.kv.List(s.prefix(), nil)
+	if err != nil {
+		return nil, err
+	} else if len(pairs) == 0 {
+		return nil, fmt.Errorf("key %s: %w", s.key, storage.ErrNotExist)
+	}
+
+	m := make(map[string]interface{})
+	for _, pair := range pairs {
+		path := strings.TrimPrefix(pair.Key, s.prefix())
+		if path == "" || strings.HasSuffix(path, "/") {
+			// Folder entries do not hold values
+			continue
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(pair.Value, &value); err != nil {
+			return nil, fmt.Errorf("key %s: %w", pair.Key, err)
+		}
+		structconf.SetPath(m, strings.Split(path, "/"), value)
+	}
+
+	return s.tree.MarshalFrom(m)
+}
+
+// flatten calls set for every leaf value of the map representation m with the value's key
+// and its JSON encoding
+func flatten(prefix string, m interface{}, set func(key string, value []byte)) error {
+	switch typed := m.(type) {
+	case map[string]interface{}:
+		for k, v := range typed {
+			if err := flatten(prefix+k+"/", v, set); err != nil {
+				return err
+			}
+		}
+	case map[interface{}]interface{}:
+		for k, v := range typed {
+			if err := flatten(prefix+fmt.Sprint(k)+"/", v, set); err != nil {
+				return err
+			}
+		}
+	default:
+		value, err := json.Marshal(typed)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", strings.TrimSuffix(prefix, "/"), err)
+		}
+		set(strings.TrimSuffix(prefix, "/"), value)
+	}
+	return nil
+}
+
+// casFailed checks if a transaction, whose first operation is a check-and-set operation, failed
+// because of that operation's index only
+func casFailed(resp *api.KVTxnResponse) bool {
+	if len(resp.Errors) == 0 {
+		return false
+	}
+	for _, txnErr := range resp.Errors {
+		if txnErr.OpIndex != 0 || !strings.Contains(txnErr.What, casFailure) {
+			return false
+		}
+	}
+	return true
+}
+
+// txnErrors describes the errors of a failed transaction
+func txnErrors(resp *api.KVTxnResponse) string {
+	whats := make([]string, 0, len(resp.Errors))
+	for _, txnErr := range resp.Errors {
+		whats = append(whats, txnErr.What)
+	}
+	return strings.Join(whats, ", ")
+}
+
+// indexVersion returns the storage version for the given ModifyIndex
+func indexVersion(index uint64) storage.Version {
+	return storage.Version(strconv.FormatUint(index, 10))
+}
+
+// NewConsulStorage initializes a new configuration storage, which stores the configuration as
+// value of the given key using the passed Consul client
+func NewConsulStorage(client *api.Client, key string, options ...Option) storage.Storage {
+	s := &consulStorage{
+		kv:       client.KV(),
+		key:      key,
+		waitTime: DefaultWaitTime,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
@@ -0,0 +1,302 @@
+package consul_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/anexia-it/go-structconf/encoding/yaml"
+	"github.com/anexia-it/go-structconf/storage"
+	"github.com/anexia-it/go-structconf/storage/consul"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConsul implements the parts of the Consul KV and transaction API used by the storage
+type fakeConsul struct {
+	index   uint64
+	entries map[string]*api.KVPair
+
+	// blocking holds the number of pending blocking queries
+	blocking int
+
+	// changed is closed and replaced on every change, to wake up blocking queries
+	changed chan struct{}
+	mutex   sync.Mutex
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{
+		index:   1,
+		entries: make(map[string]*api.KVPair),
+		changed: make(chan struct{}),
+	}
+}
+
+// set changes an entry, like another client would
+func (f *fakeConsul) set(key string, value string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.index++
+	f.entries[key] = &api.KVPair{Key: key, Value: []byte(value), ModifyIndex: f.index}
+	f.notify()
+}
+
+// notify wakes up blocking queries. The mutex must be held.
+func (f *fakeConsul) notify() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/v1/txn" && r.Method == http.MethodPut:
+		f.txn(w, r)
+	case strings.HasPrefix(r.URL.Path, "/v1/kv/") && r.Method == http.MethodGet:
+		f.get(w, r, strings.TrimPrefix(r.URL.Path, "/v1/kv/"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeConsul) get(w http.ResponseWriter, r *http.Request, key string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	// Blocking query
+	if index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); index > 0 && index >= f.index {
+		wait, _ := time.ParseDuration(r.URL.Query().Get("wait"))
+		changed := f.changed
+
+		f.blocking++
+		f.mutex.Unlock()
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		case <-r.Context().Done():
+		}
+		f.mutex.Lock()
+		f.blocking--
+	}
+
+	pairs := make(api.KVPairs, 0)
+	for _, pair := range f.entries {
+		if pair.Key == key || (r.URL.Query().Has("recurse") && strings.HasPrefix(pair.Key, key)) {
+			pairs = append(pairs, pair)
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Key < pairs[j].Key
+	})
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+	if len(pairs) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(pairs)
+}
+
+func (f *fakeConsul) txn(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var ops api.TxnOps
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Check all operations before applying any of them
+	var txnErrors api.TxnErrors
+	for i, op := range ops {
+		existing := f.entries[op.KV.Key]
+		if strings.HasPrefix(op.KV.Key, "denied/") {
+			txnErrors = append(txnErrors, &api.TxnError{OpIndex: i, What: "Permission denied"})
+		} else if op.KV.Verb == api.KVCAS && ((op.KV.Index == 0 && existing != nil) ||
+			(op.KV.Index != 0 && (existing == nil || existing.ModifyIndex != op.KV.Index))) {
+			txnErrors = append(txnErrors, &api.TxnError{OpIndex: i,
+				What: fmt.Sprintf("failed to set key %q, index is stale", op.KV.Key)})
+		}
+	}
+	if len(txnErrors) > 0 {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(api.TxnResponse{Errors: txnErrors})
+		return
+	}
+
+	f.index++
+	var results api.TxnResults
+	for _, op := range ops {
+		switch op.KV.Verb {
+		case api.KVSet, api.KVCAS:
+			f.entries[op.KV.Key] = &api.KVPair{Key: op.KV.Key, Value: op.KV.Value, ModifyIndex: f.index}
+			results = append(results, &api.TxnResult{KV: &api.KVPair{Key: op.KV.Key, ModifyIndex: f.index}})
+		case api.KVGet:
+			results = append(results, &api.TxnResult{KV: f.entries[op.KV.Key]})
+		case api.KVDeleteTree:
+			for key := range f.entries {
+				if strings.HasPrefix(key, op.KV.Key) {
+					delete(f.entries, key)
+				}
+			}
+		}
+	}
+	f.notify()
+
+	json.NewEncoder(w).Encode(api.TxnResponse{Results: results})
+}
+
+// startConsul starts a fake Consul server and returns a client connected to it
+func startConsul(t *testing.T) (*api.Client, *fakeConsul) {
+	fake := newFakeConsul()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	require.NoError(t, err)
+	return client, fake
+}
+
+func TestConsulStorage(t *testing.T) {
+	client, fake := startConsul(t)
+	s := consul.NewConsulStorage(client, "app/config")
+
+	// Missing entries are reported as such
+	_, err := s.ReadConfig()
+	require.ErrorIs(t, err, storage.ErrNotExist)
+
+	require.NoError(t, s.WriteConfig([]byte(`{"test":"written"}`)))
+	inBytes, err := s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"written"}`, string(inBytes))
+
+	require.EqualValues(t, "app/config", fmt.Sprint(s))
+
+	// Versions are compared using the entry's ModifyIndex
+	versioned := s.(storage.Versioned)
+	_, err = versioned.WriteConfigVersion([]byte("conflicting"), storage.NoVersion)
+	require.ErrorIs(t, err, storage.ErrConflict)
+
+	_, version, err := versioned.ReadConfigVersion()
+	require.NoError(t, err)
+	newVersion, err := versioned.WriteConfigVersion([]byte("first"), version)
+	require.NoError(t, err)
+	require.NotEqual(t, version, newVersion)
+
+	fake.set("app/config", "other")
+	_, err = versioned.WriteConfigVersion([]byte("second"), newVersion)
+	require.ErrorIs(t, err, storage.ErrConflict)
+
+	// Other failures of the transaction are not reported as conflicts
+	denied := consul.NewConsulStorage(client, "denied/config").(storage.Versioned)
+	_, err = denied.WriteConfigVersion([]byte("denied"), storage.NoVersion)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, storage.ErrConflict)
+	require.Contains(t, err.Error(), "Permission denied")
+}
+
+func TestConsulStorage_Tree(t *testing.T) {
+	client, fake := startConsul(t)
+	enc, err := yaml.NewYAMLEncoding()
+	require.NoError(t, err)
+
+	s := consul.NewConsulStorage(client, "app/config", consul.OptionTree(enc))
+
+	_, err = s.ReadConfig()
+	require.ErrorIs(t, err, storage.ErrNotExist)
+
+	require.NoError(t, s.WriteConfig([]byte("name: test\ndatabase:\n  host: db\n  port: 5432\ntags:\n- a\n- b\n")))
+
+	// Every leaf value is stored as a separate entry
+	require.EqualValues(t, []string{
+		"app/config/database/host",
+		"app/config/database/port",
+		"app/config/name",
+		"app/config/tags",
+	}, sortedKeys(fake))
+	require.EqualValues(t, "5432", string(fake.entries["app/config/database/port"].Value))
+
+	inBytes, err := s.ReadConfig()
+	require.NoError(t, err)
+	m := make(map[string]interface{})
+	require.NoError(t, enc.UnmarshalTo(inBytes, m))
+	require.EqualValues(t, "test", m["name"])
+	require.EqualValues(t, []interface{}{"a", "b"}, m["tags"])
+
+	// Writing replaces all entries
+	require.NoError(t, s.WriteConfig([]byte("name: replaced\n")))
+	require.EqualValues(t, []string{"app/config/name"}, sortedKeys(fake))
+
+	// Versions are not supported in tree mode
+	_, _, err = s.(storage.Versioned).ReadConfigVersion()
+	require.ErrorIs(t, err, storage.ErrVersionNotSupported)
+
+	// Configurations exceeding a single transaction are rejected without writing any entries
+	var large strings.Builder
+	for i := 0; i < 64; i++ {
+		fmt.Fprintf(&large, "key%d: %d\n", i, i)
+	}
+	require.ErrorIs(t, s.WriteConfig([]byte(large.String())), consul.ErrTooManyEntries)
+	require.EqualValues(t, []string{"app/config/name"}, sortedKeys(fake))
+}
+
+func TestConsulStorage_Watch(t *testing.T) {
+	client, fake := startConsul(t)
+	s := consul.NewConsulStorage(client, "app/config", consul.OptionWaitTime(time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := s.(storage.Watcher).Watch(ctx)
+	require.NoError(t, err)
+
+	// Wait for the initial query to complete
+	require.Eventually(t, func() bool {
+		fake.mutex.Lock()
+		defer fake.mutex.Unlock()
+		return fake.blocking > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	fake.set("app/config", "changed")
+	select {
+	case _, ok := <-changes:
+		require.True(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Change of entry not reported")
+	}
+
+	// Cancelling the context closes the channel
+	cancel()
+	require.Eventually(t, func() bool {
+		select {
+		case _, ok := <-changes:
+			return !ok
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// sortedKeys returns the keys of all entries stored by the fake Consul server
+func sortedKeys(f *fakeConsul) []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	keys := make([]string, 0, len(f.entries))
+	for key := range f.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,141 @@
+// Package dir provides drop-in directory configuration storage for go-structconf
+package dir
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/anexia-it/go-structconf/storage"
+)
+
+var _ storage.Storage = (*dirStorage)(nil)
+var _ storage.MultiDocument = (*dirStorage)(nil)
+var _ storage.Watcher = (*dirStorage)(nil)
+
+// drop-in directory storage implementation
+type dirStorage struct {
+	path    string
+	pattern string
+}
+
+// WriteConfig returns storage.ErrReadOnly, as drop-in directories are managed externally
+func (s *dirStorage) WriteConfig([]byte) error {
+	return storage.ErrReadOnly
+}
+
+// ReadConfig returns storage.ErrMultipleDocuments, the files are read using ReadConfigs
+func (s *dirStorage) ReadConfig() ([]byte, error) {
+	return nil, storage.ErrMultipleDocuments
+}
+
+// ReadConfigs reads all files matching the pattern in lexical order of their names.
+// The documents are named by the paths of the files.
+func (s *dirStorage) ReadConfigs() ([]storage.Document, error) {
+	// Entries are sorted by name
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	documents := make([]storage.Document, 0, len(entries))
+	for _, entry := range entries {
+		if matches, err := s.matches(entry.Name()); err != nil {
+			return nil, err
+		} else if !matches {
+			continue
+		}
+
+		path := filepath.Join(s.path, entry.Name())
+
+		// Stat the path instead of using the entry, so symbolic links are followed
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		} else if info.IsDir() {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, storage.Document{Name: path, Data: data})
+	}
+
+	return documents, nil
+}
+
+// matches checks if the file with the given name is part of the configuration.
+// Hidden files, like temporary files of editors, are ignored.
+func (s *dirStorage) matches(name string) (bool, error) {
+	if strings.HasPrefix(name, ".") {
+		return false, nil
+	}
+	return filepath.Match(s.pattern, name)
+}
+
+// String returns the pattern of the files, including the path of the directory
+func (s *dirStorage) String() string {
+	return filepath.Join(s.path, s.pattern)
+}
+
+// Watch observes the directory for changes of matching files using inotify (or the platform's
+// equivalent)
+func (s *dirStorage) Watch(ctx context.Context) (<-chan struct{}, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := watcher.Add(s.path); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+		defer watcher.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if matches, _ := s.matches(filepath.Base(event.Name)); !matches || event.Op == fsnotify.Chmod {
+					// Event for a file which is not part of the configuration or only the permissions changed
+					continue
+				}
+				storage.Notify(changes)
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				// Events may have been lost, so better have the consumer re-read the files
+				storage.Notify(changes)
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// NewDirStorage initializes a new drop-in directory configuration storage, which reads all files
+// in the directory at path whose names match the pattern, like "*.yaml".
+// The pattern syntax is described at filepath.Match.
+//
+// The storage implements storage.MultiDocument, so the files are decoded separately and applied
+// in lexical order of their names when the configuration is loaded. It is read-only.
+func NewDirStorage(path string, pattern string) storage.Storage {
+	return &dirStorage{
+		path:    path,
+		pattern: pattern,
+	}
+}
@@ -0,0 +1,109 @@
+package dir_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anexia-it/go-structconf/storage"
+	"github.com/anexia-it/go-structconf/storage/dir"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirStorage(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "go-structconf-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, "20-second.yaml"), []byte("second"), 0640))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, "10-first.yaml"), []byte("first"), 0640))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, "30-other.json"), []byte("other"), 0640))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, ".10-first.yaml.swp"), []byte("hidden"), 0640))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, ".hidden.yaml"), []byte("hidden"), 0640))
+	require.NoError(t, os.Mkdir(filepath.Join(tmpDir, "40-directory.yaml"), 0750))
+	require.NoError(t, os.Symlink(filepath.Join(tmpDir, "20-second.yaml"), filepath.Join(tmpDir, "50-link.yaml")))
+
+	s := dir.NewDirStorage(tmpDir, "*.yaml")
+	multi, ok := s.(storage.MultiDocument)
+	require.True(t, ok, "Directory storage does not implement storage.MultiDocument")
+
+	// Matching files are read in lexical order
+	documents, err := multi.ReadConfigs()
+	require.NoError(t, err)
+	require.EqualValues(t, []storage.Document{
+		{Name: filepath.Join(tmpDir, "10-first.yaml"), Data: []byte("first")},
+		{Name: filepath.Join(tmpDir, "20-second.yaml"), Data: []byte("second")},
+		{Name: filepath.Join(tmpDir, "50-link.yaml"), Data: []byte("second")},
+	}, documents)
+
+	// The storage is read-only and only provides multiple documents
+	require.ErrorIs(t, s.WriteConfig([]byte("test")), storage.ErrReadOnly)
+	_, err = s.ReadConfig()
+	require.ErrorIs(t, err, storage.ErrMultipleDocuments)
+
+	require.EqualValues(t, filepath.Join(tmpDir, "*.yaml"), fmt.Sprint(s))
+}
+
+func TestDirStorage_Missing(t *testing.T) {
+	s := dir.NewDirStorage("/nonexistent/go-structconf/conf.d", "*.yaml")
+
+	_, err := s.(storage.MultiDocument).ReadConfigs()
+	require.ErrorIs(t, err, storage.ErrNotExist)
+}
+
+func TestDirStorage_BadPattern(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "go-structconf-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, "config.yaml"), []byte("test"), 0640))
+
+	s := dir.NewDirStorage(tmpDir, "[")
+	_, err = s.(storage.MultiDocument).ReadConfigs()
+	require.ErrorIs(t, err, filepath.ErrBadPattern)
+}
+
+func TestDirStorage_Watch(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "go-structconf-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	s := dir.NewDirStorage(tmpDir, "*.yaml")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := s.(storage.Watcher).Watch(ctx)
+	require.NoError(t, err)
+
+	// Changes to files which are not part of the configuration must not be reported
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, "other.json"), []byte("other"), 0640))
+	select {
+	case <-changes:
+		t.Fatal("Change of unrelated file reported")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Added fragments must be reported
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, "10-fragment.yaml"), []byte("test"), 0640))
+	select {
+	case _, ok := <-changes:
+		require.True(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Added fragment not reported")
+	}
+
+	// Cancelling the context closes the channel
+	cancel()
+	require.Eventually(t, func() bool {
+		select {
+		case _, ok := <-changes:
+			return !ok
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+}
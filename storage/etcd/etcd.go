@@ -0,0 +1,175 @@
+// Package etcd provides configuration storage for go-structconf backed by an etcd v3 key
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/anexia-it/go-structconf/storage"
+)
+
+// DefaultTimeout defines the timeout of each request, unless configured otherwise using
+// OptionTimeout
+const DefaultTimeout = 5 * time.Second
+
+// watchRetryInterval defines the delay before a watch cancelled by the server is re-established
+const watchRetryInterval = time.Second
+
+var _ storage.Storage = (*etcdStorage)(nil)
+var _ storage.Watcher = (*etcdStorage)(nil)
+var _ storage.Versioned = (*etcdStorage)(nil)
+
+// Option defines the function type of etcd storage options
+type Option func(*etcdStorage)
+
+// OptionTimeout configures the timeout of each request
+func OptionTimeout(timeout time.Duration) Option {
+	return func(s *etcdStorage) {
+		s.timeout = timeout
+	}
+}
+
+// etcd-based storage implementation
+type etcdStorage struct {
+	client  *clientv3.Client
+	key     string
+	timeout time.Duration
+}
+
+func (s *etcdStorage) WriteConfig(data []byte) error {
+	_, err := s.WriteConfigVersion(data, storage.AnyVersion)
+	return err
+}
+
+func (s *etcdStorage) ReadConfig() ([]byte, error) {
+	data, _, err := s.ReadConfigVersion()
+	return data, err
+}
+
+// ReadConfigVersion reads the value of the key, using its modification revision as version
+func (s *etcdStorage) ReadConfigVersion() ([]byte, storage.Version, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	resp, err := s.client.Get(ctx, s.key)
+	if err != nil {
+		return nil, storage.NoVersion, err
+	} else if len(resp.Kvs) == 0 {
+		return nil, storage.NoVersion, fmt.Errorf("key %s: %w", s.key, storage.ErrNotExist)
+	}
+
+	kv := resp.Kvs[0]
+	return kv.Value, revisionVersion(kv.ModRevision), nil
+}
+
+// WriteConfigVersion writes the value of the key in a transaction, which compares the key's
+// modification revision with the expected version
+func (s *etcdStorage) WriteConfigVersion(data []byte, expected storage.Version) (storage.Version, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	if expected == storage.AnyVersion {
+		resp, err := s.client.Put(ctx, s.key, string(data))
+		if err != nil {
+			return storage.NoVersion, err
+		}
+		return revisionVersion(resp.Header.Revision), nil
+	}
+
+	// A key which does not exist has a modification revision of 0
+	var revision int64
+	if expected != storage.NoVersion {
+		var err error
+		if revision, err = strconv.ParseInt(string(expected), 10, 64); err != nil {
+			return storage.NoVersion, fmt.Errorf("invalid version %q: %w", expected, err)
+		}
+	}
+
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(s.key), "=", revision)).
+		Then(clientv3.OpPut(s.key, string(data))).
+		Commit()
+	if err != nil {
+		return storage.NoVersion, err
+	} else if !resp.Succeeded {
+		return storage.NoVersion, storage.ErrConflict
+	}
+
+	return revisionVersion(resp.Header.Revision), nil
+}
+
+// Watch observes the key using an etcd watch.
+//
+// Watches cancelled by the server, like after the leader was lost or if the watched revision has
+// been compacted, are re-established after the last observed revision until the context is done.
+func (s *etcdStorage) Watch(ctx context.Context) (<-chan struct{}, error) {
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+
+		var revision int64
+		for retry := false; ; retry = true {
+			var opts []clientv3.OpOption
+			if revision > 0 {
+				opts = append(opts, clientv3.WithRev(revision+1))
+			}
+
+			watchChan := s.client.Watch(clientv3.WithRequireLeader(ctx), s.key, opts...)
+			if retry {
+				// Changes may have been missed while the watch was cancelled
+				storage.Notify(changes)
+			}
+
+			for resp := range watchChan {
+				if resp.CompactRevision > 0 {
+					// The revisions after the last observed one are gone, resume at the oldest one left
+					revision = resp.CompactRevision - 1
+				} else if resp.Header.Revision > revision {
+					revision = resp.Header.Revision
+				}
+
+				// Responses signalling errors are reported as well, as events may have been lost
+				storage.Notify(changes)
+			}
+
+			// The watch channel is closed once the context is done or the server cancelled the watch
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(watchRetryInterval):
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// String returns the key
+func (s *etcdStorage) String() string {
+	return s.key
+}
+
+// revisionVersion returns the storage version for the given revision
+func revisionVersion(revision int64) storage.Version {
+	return storage.Version(strconv.FormatInt(revision, 10))
+}
+
+// NewEtcdStorage initializes a new configuration storage, which stores the configuration as value
+// of the given key using the passed etcd client
+func NewEtcdStorage(client *clientv3.Client, key string, options ...Option) storage.Storage {
+	s := &etcdStorage{
+		client:  client,
+		key:     key,
+		timeout: DefaultTimeout,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
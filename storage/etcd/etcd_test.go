@@ -0,0 +1,180 @@
+package etcd_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+
+	"github.com/anexia-it/go-structconf/storage"
+	"github.com/anexia-it/go-structconf/storage/etcd"
+	"github.com/stretchr/testify/require"
+)
+
+// freeURL returns a URL of a local port which is currently not in use
+func freeURL(t *testing.T) url.URL {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	return url.URL{Scheme: "http", Host: listener.Addr().String()}
+}
+
+// startEtcd starts an embedded etcd server and returns a client connected to it
+func startEtcd(t *testing.T) *clientv3.Client {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+
+	clientURL, peerURL := freeURL(t), freeURL(t)
+	cfg.ListenClientUrls = []url.URL{clientURL}
+	cfg.AdvertiseClientUrls = []url.URL{clientURL}
+	cfg.ListenPeerUrls = []url.URL{peerURL}
+	cfg.AdvertisePeerUrls = []url.URL{peerURL}
+	cfg.InitialCluster = fmt.Sprintf("%s=%s", cfg.Name, peerURL.String())
+
+	server, err := embed.StartEtcd(cfg)
+	require.NoError(t, err)
+	t.Cleanup(server.Close)
+
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		t.Fatal("Embedded etcd did not start")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{clientURL.String()},
+		DialTimeout: 5 * time.Second,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		client.Close()
+	})
+
+	return client
+}
+
+func TestEtcdStorage(t *testing.T) {
+	client := startEtcd(t)
+	s := etcd.NewEtcdStorage(client, "/app/config")
+
+	// Missing keys are reported as such
+	_, err := s.ReadConfig()
+	require.ErrorIs(t, err, storage.ErrNotExist)
+
+	require.NoError(t, s.WriteConfig([]byte(`{"test":"written"}`)))
+	inBytes, err := s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"written"}`, string(inBytes))
+
+	require.EqualValues(t, "/app/config", fmt.Sprint(s))
+
+	// Versions are compared using the key's revision
+	versioned := s.(storage.Versioned)
+	_, err = versioned.WriteConfigVersion([]byte("conflicting"), storage.NoVersion)
+	require.ErrorIs(t, err, storage.ErrConflict)
+
+	_, version, err := versioned.ReadConfigVersion()
+	require.NoError(t, err)
+	newVersion, err := versioned.WriteConfigVersion([]byte("first"), version)
+	require.NoError(t, err)
+	require.NotEqual(t, version, newVersion)
+
+	_, err = client.Put(context.Background(), "/app/config", "other")
+	require.NoError(t, err)
+	_, err = versioned.WriteConfigVersion([]byte("second"), newVersion)
+	require.ErrorIs(t, err, storage.ErrConflict)
+}
+
+func TestEtcdStorage_Watch(t *testing.T) {
+	client := startEtcd(t)
+	s := etcd.NewEtcdStorage(client, "/app/config")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := s.(storage.Watcher).Watch(ctx)
+	require.NoError(t, err)
+
+	// Changes of other keys must not be reported
+	_, err = client.Put(context.Background(), "/app/other", "other")
+	require.NoError(t, err)
+	select {
+	case <-changes:
+		t.Fatal("Change of unrelated key reported")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	_, err = client.Put(context.Background(), "/app/config", "changed")
+	require.NoError(t, err)
+	select {
+	case _, ok := <-changes:
+		require.True(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Change of key not reported")
+	}
+
+	// Cancelling the context closes the channel
+	cancel()
+	require.Eventually(t, func() bool {
+		select {
+		case _, ok := <-changes:
+			return !ok
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// cancelledWatcher closes the channel of the first watch, like etcd does if the server cancels a watch
+type cancelledWatcher struct {
+	clientv3.Watcher
+	watches int32
+}
+
+func (w *cancelledWatcher) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	if atomic.AddInt32(&w.watches, 1) == 1 {
+		watchChan := make(chan clientv3.WatchResponse)
+		close(watchChan)
+		return watchChan
+	}
+	return w.Watcher.Watch(ctx, key, opts...)
+}
+
+func TestEtcdStorage_Watch_Cancelled(t *testing.T) {
+	client := startEtcd(t)
+	watcher := &cancelledWatcher{Watcher: client.Watcher}
+	client.Watcher = watcher
+	s := etcd.NewEtcdStorage(client, "/app/config")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := s.(storage.Watcher).Watch(ctx)
+	require.NoError(t, err)
+
+	// The watch is re-established, reporting the changes which may have been missed meanwhile
+	select {
+	case _, ok := <-changes:
+		require.True(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Re-established watch not reported")
+	}
+	require.EqualValues(t, 2, atomic.LoadInt32(&watcher.watches))
+
+	_, err = client.Put(context.Background(), "/app/config", "changed")
+	require.NoError(t, err)
+	select {
+	case _, ok := <-changes:
+		require.True(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Change of key not reported")
+	}
+}
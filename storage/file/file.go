@@ -2,40 +2,280 @@
 package file
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
 
 	"github.com/anexia-it/go-structconf/storage"
 )
 
+// DefaultLockTimeout defines how long reads and writes wait for a lock held by another process,
+// unless configured otherwise using OptionLockTimeout
+const DefaultLockTimeout = 10 * time.Second
+
+// lockRetryInterval defines the interval in which acquiring a held lock is retried
+const lockRetryInterval = 10 * time.Millisecond
+
 var _ storage.Storage = (*fileStorage)(nil)
+var _ storage.Watcher = (*fileStorage)(nil)
+var _ storage.Versioned = (*fileStorage)(nil)
+
+// Option defines the function type of file storage options
+type Option func(*fileStorage)
+
+// OptionLockTimeout configures how long reads and writes wait for a lock held by another process.
+// With a timeout of zero, the lock is tried only once.
+func OptionLockTimeout(timeout time.Duration) Option {
+	return func(fs *fileStorage) {
+		fs.lockTimeout = timeout
+	}
+}
 
 // file-based storage implementation
 type fileStorage struct {
-	path  string
-	mode  os.FileMode
-	mutex sync.Mutex
+	path        string
+	mode        os.FileMode
+	lockTimeout time.Duration
+	mutex       sync.Mutex
+}
+
+// lockPath returns the path of the lock file protecting the file
+func (fs *fileStorage) lockPath() string {
+	return fs.path + ".lock"
 }
 
+// WriteConfig replaces the file atomically.
+//
+// The data is written to a temporary file in the same directory, which is synced to disk and
+// renamed over the file afterwards. This ensures the file either holds the previous or the new
+// configuration, even if writing fails half-way. The temporary file is created with the configured
+// mode and, where possible, the owner of the file being replaced.
+// If the path refers to a symbolic link, the file the link points to is replaced.
+//
+// Writes hold an exclusive lock, see NewFileStorage.
 func (fs *fileStorage) WriteConfig(data []byte) error {
+	_, err := fs.WriteConfigVersion(data, storage.AnyVersion)
+	return err
+}
+
+// WriteConfigVersion replaces the file like WriteConfig, iff its version still matches the
+// expected version. The version consists of the file's modification time, size and a hash of
+// its contents, see storage.FileVersion.
+func (fs *fileStorage) WriteConfigVersion(data []byte, expected storage.Version) (storage.Version, error) {
 	fs.mutex.Lock()
 	defer fs.mutex.Unlock()
 
-	return ioutil.WriteFile(fs.path, data, fs.mode)
+	unlock, err := fs.lock(true)
+	if err != nil {
+		return storage.NoVersion, err
+	}
+	defer unlock()
+
+	if expected != storage.AnyVersion {
+		_, current, err := fs.read()
+		if err != nil && !errors.Is(err, storage.ErrNotExist) {
+			return storage.NoVersion, err
+		} else if current != expected {
+			return storage.NoVersion, storage.ErrConflict
+		}
+	}
+
+	path := fs.path
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	if err := writeAtomic(path, data, fs.mode); err != nil {
+		return storage.NoVersion, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return storage.NoVersion, err
+	}
+	return storage.FileVersion(info, data), nil
 }
 
+// writeAtomic writes data to a temporary file and renames it over the file at path
+func writeAtomic(path string, data []byte, mode os.FileMode) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+
+	if err := writeTempFile(tmpFile, path, data, mode); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	// Persist the rename itself
+	return syncDir(filepath.Dir(path))
+}
+
+// writeTempFile writes data to the temporary file replacing path and syncs it to disk
+func writeTempFile(tmpFile *os.File, path string, data []byte, mode os.FileMode) error {
+	if err := tmpFile.Chmod(mode); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		preserveOwner(tmpFile, info)
+	}
+
+	if _, err := tmpFile.Write(data); err != nil {
+		return err
+	}
+
+	return tmpFile.Sync()
+}
+
+// ReadConfig reads the file while holding a shared lock, see NewFileStorage
 func (fs *fileStorage) ReadConfig() ([]byte, error) {
+	data, _, err := fs.ReadConfigVersion()
+	return data, err
+}
+
+// ReadConfigVersion reads the file like ReadConfig, along with its version
+func (fs *fileStorage) ReadConfigVersion() ([]byte, storage.Version, error) {
 	fs.mutex.Lock()
 	defer fs.mutex.Unlock()
 
-	return ioutil.ReadFile(fs.path)
+	unlock, err := fs.lock(false)
+	if err != nil {
+		return nil, storage.NoVersion, err
+	}
+	defer unlock()
+
+	return fs.read()
+}
+
+// read reads the file and determines its version
+func (fs *fileStorage) read() ([]byte, storage.Version, error) {
+	f, err := os.Open(fs.path)
+	if err != nil {
+		return nil, storage.NoVersion, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, storage.NoVersion, err
+	}
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, storage.NoVersion, err
+	}
+
+	return data, storage.FileVersion(info, data), nil
+}
+
+// String returns the path of the file
+func (fs *fileStorage) String() string {
+	return fs.path
+}
+
+// Watch observes the file for changes using inotify (or the platform's equivalent).
+//
+// The directory containing the file is watched instead of the file itself, which ensures
+// changes are also picked up if the file is replaced, as many editors do.
+func (fs *fileStorage) Watch(ctx context.Context) (<-chan struct{}, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Clean(fs.path)
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+		defer watcher.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != path || event.Op == fsnotify.Chmod {
+					// Event for another file in the same directory or only the permissions changed
+					continue
+				}
+				storage.Notify(changes)
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				// Events may have been lost, so better have the consumer re-read the file
+				storage.Notify(changes)
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// acquire calls try until it acquired the lock, failed or the timeout expired
+func acquire(timeout time.Duration, try func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		acquired, err := try()
+		if err != nil {
+			return err
+		} else if acquired {
+			return nil
+		}
+
+		if !time.Now().Before(deadline) {
+			return storage.ErrLockTimeout
+		}
+		time.Sleep(lockRetryInterval)
+	}
 }
 
 // NewFileStorage initializes a new file-based configuration storage
-func NewFileStorage(path string, mode os.FileMode) storage.Storage {
-	return &fileStorage{
-		path: path,
-		mode: mode,
+//
+// Reads and writes are protected from concurrent access by other processes using an advisory lock
+// on a lock file next to the file, named like the file with a ".lock" suffix. On platforms
+// supporting flock, the lock file is kept and reads share the lock. Elsewhere, the lock is held by
+// creating the lock file, which is removed again afterwards.
+// If the lock cannot be acquired within the timeout configured using OptionLockTimeout,
+// storage.ErrLockTimeout is returned. Processes which cannot create the lock file, for example due
+// to lacking write permissions for the directory, read the file without holding a lock.
+func NewFileStorage(path string, mode os.FileMode, options ...Option) storage.Storage {
+	fs := &fileStorage{
+		path:        path,
+		mode:        mode,
+		lockTimeout: DefaultLockTimeout,
+	}
+
+	for _, opt := range options {
+		opt(fs)
 	}
+
+	return fs
 }
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package file
+
+import "os"
+
+// preserveOwner is a no-op, as file ownership is not supported on this platform
+func preserveOwner(*os.File, os.FileInfo) {}
+
+// syncDir is a no-op, as directories cannot be synced on this platform
+func syncDir(string) error {
+	return nil
+}
@@ -1,10 +1,15 @@
 package file_test
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/anexia-it/go-structconf/storage"
 	"github.com/anexia-it/go-structconf/storage/file"
 	"github.com/stretchr/testify/require"
 )
@@ -42,3 +47,176 @@ func TestFileStorage(t *testing.T) {
 	require.NoError(t, err)
 	require.EqualValues(t, testContents, inBytes)
 }
+
+func TestFileStorage_WriteConfig_Atomic(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "go-structconf-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	configPath := filepath.Join(tmpDir, "config.json")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte("old contents"), 0644))
+
+	// Keep the old file open, to verify it is replaced instead of being truncated
+	oldFile, err := os.Open(configPath)
+	require.NoError(t, err)
+	defer oldFile.Close()
+
+	s := file.NewFileStorage(configPath, 0600)
+	require.NoError(t, s.WriteConfig([]byte("new contents")))
+
+	inBytes, err := ioutil.ReadFile(configPath)
+	require.NoError(t, err)
+	require.EqualValues(t, "new contents", string(inBytes))
+
+	oldBytes, err := ioutil.ReadAll(oldFile)
+	require.NoError(t, err)
+	require.EqualValues(t, "old contents", string(oldBytes))
+
+	// The configured mode is applied
+	info, err := os.Stat(configPath)
+	require.NoError(t, err)
+	require.EqualValues(t, os.FileMode(0600), info.Mode().Perm())
+
+	// No temporary files are left behind
+	tmpFiles, err := filepath.Glob(filepath.Join(tmpDir, ".config.json.tmp-*"))
+	require.NoError(t, err)
+	require.Empty(t, tmpFiles)
+}
+
+func TestFileStorage_WriteConfig_Symlink(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "go-structconf-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	targetPath := filepath.Join(tmpDir, "target.json")
+	linkPath := filepath.Join(tmpDir, "config.json")
+	require.NoError(t, ioutil.WriteFile(targetPath, []byte("old contents"), 0640))
+	require.NoError(t, os.Symlink(targetPath, linkPath))
+
+	s := file.NewFileStorage(linkPath, 0640)
+	require.NoError(t, s.WriteConfig([]byte("new contents")))
+
+	// The link is kept and the file it points to is replaced
+	info, err := os.Lstat(linkPath)
+	require.NoError(t, err)
+	require.True(t, info.Mode()&os.ModeSymlink != 0)
+
+	inBytes, err := ioutil.ReadFile(targetPath)
+	require.NoError(t, err)
+	require.EqualValues(t, "new contents", string(inBytes))
+}
+
+func TestFileStorage_WriteConfig_DirectoryMissing(t *testing.T) {
+	s := file.NewFileStorage("/nonexistent/go-structconf/config.json", 0640)
+	require.Error(t, s.WriteConfig([]byte("test contents")))
+}
+
+func TestFileStorage_Watch(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "go-structconf-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	configPath := filepath.Join(tmpDir, "config.json")
+	otherPath := filepath.Join(tmpDir, "other.json")
+
+	s := file.NewFileStorage(configPath, 0640)
+	require.NotNil(t, s)
+
+	watcher, ok := s.(storage.Watcher)
+	require.True(t, ok, "File storage does not implement storage.Watcher")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := watcher.Watch(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, changes)
+
+	// Changes to other files in the same directory must not be reported
+	require.NoError(t, ioutil.WriteFile(otherPath, []byte("other"), 0640))
+	select {
+	case <-changes:
+		t.Fatal("Change of unrelated file reported")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Changes to the config file must be reported
+	require.NoError(t, s.WriteConfig([]byte("test contents")))
+	select {
+	case _, ok := <-changes:
+		require.True(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Change of config file not reported")
+	}
+
+	// Replacing the file must be reported as well
+	require.NoError(t, os.Rename(otherPath, configPath))
+	select {
+	case _, ok := <-changes:
+		require.True(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Replacement of config file not reported")
+	}
+
+	// Cancelling the context closes the channel
+	cancel()
+	require.Eventually(t, func() bool {
+		select {
+		case _, ok := <-changes:
+			return !ok
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestFileStorage_Watch_DirectoryMissing(t *testing.T) {
+	s := file.NewFileStorage("/nonexistent/go-structconf/config.json", 0640)
+
+	changes, err := s.(storage.Watcher).Watch(context.Background())
+	require.Error(t, err)
+	require.Nil(t, changes)
+}
+
+func TestFileStorage_String(t *testing.T) {
+	s := file.NewFileStorage("/etc/app/config.json", 0640)
+	require.EqualValues(t, "/etc/app/config.json", fmt.Sprint(s))
+}
+
+func TestFileStorage_Versioned(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "go-structconf-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	configPath := filepath.Join(tmpDir, "config.json")
+	s, ok := file.NewFileStorage(configPath, 0640).(storage.Versioned)
+	require.True(t, ok, "File storage does not implement storage.Versioned")
+
+	// A missing file has no version
+	_, version, err := s.ReadConfigVersion()
+	require.ErrorIs(t, err, storage.ErrNotExist)
+	require.EqualValues(t, storage.NoVersion, version)
+
+	// Writes expecting a missing file fail once it exists
+	written, err := s.WriteConfigVersion([]byte("first"), storage.NoVersion)
+	require.NoError(t, err)
+	require.NotEqual(t, storage.NoVersion, written)
+	_, err = s.WriteConfigVersion([]byte("second"), storage.NoVersion)
+	require.ErrorIs(t, err, storage.ErrConflict)
+
+	data, version, err := s.ReadConfigVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, "first", string(data))
+	require.EqualValues(t, written, version)
+
+	// Changes by others change the version
+	require.NoError(t, ioutil.WriteFile(configPath, []byte("other"), 0640))
+	_, err = s.WriteConfigVersion([]byte("second"), version)
+	require.ErrorIs(t, err, storage.ErrConflict)
+
+	_, err = s.WriteConfigVersion([]byte("second"), storage.AnyVersion)
+	require.NoError(t, err)
+	data, err = ioutil.ReadFile(configPath)
+	require.NoError(t, err)
+	require.EqualValues(t, "second", string(data))
+}
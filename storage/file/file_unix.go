@@ -0,0 +1,27 @@
+//go:build unix
+
+package file
+
+import (
+	"os"
+	"syscall"
+)
+
+// preserveOwner changes the owner of the file to the owner described by info.
+// Failures are ignored, as only privileged processes may hand files to other users.
+func preserveOwner(f *os.File, info os.FileInfo) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		_ = f.Chown(int(stat.Uid), int(stat.Gid))
+	}
+}
+
+// syncDir syncs the directory at the given path to disk
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
@@ -0,0 +1,45 @@
+//go:build unix && !aix && !solaris
+
+package file
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lock acquires an flock on the lock file, which is exclusive for writes and shared for reads
+func (fs *fileStorage) lock(exclusive bool) (unlock func(), err error) {
+	f, err := os.OpenFile(fs.lockPath(), os.O_RDWR|os.O_CREATE, fs.mode)
+	if err != nil && !exclusive {
+		// Readers without permission to create the lock file may still lock an existing one
+		if f, err = os.Open(fs.lockPath()); err != nil {
+			return func() {}, nil
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	fd := int(f.Fd())
+	err = acquire(fs.lockTimeout, func() (bool, error) {
+		err := syscall.Flock(fd, how|syscall.LOCK_NB)
+		if errors.Is(err, syscall.EWOULDBLOCK) || errors.Is(err, syscall.EINTR) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return func() {
+		_ = syscall.Flock(fd, syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
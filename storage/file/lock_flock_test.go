@@ -0,0 +1,73 @@
+//go:build linux
+
+package file_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/anexia-it/go-structconf/storage"
+	"github.com/anexia-it/go-structconf/storage/file"
+	"github.com/stretchr/testify/require"
+)
+
+// holdLock acquires an flock on the given path, like another process would
+func holdLock(t *testing.T, path string, how int) (release func()) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0640)
+	require.NoError(t, err)
+	require.NoError(t, syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB))
+
+	return func() {
+		require.NoError(t, syscall.Flock(int(f.Fd()), syscall.LOCK_UN))
+		f.Close()
+	}
+}
+
+func TestFileStorage_Lock(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "go-structconf-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	configPath := filepath.Join(tmpDir, "config.json")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte("old contents"), 0640))
+
+	s := file.NewFileStorage(configPath, 0640, file.OptionLockTimeout(50*time.Millisecond))
+
+	// While another process writes, neither reads nor writes acquire the lock
+	release := holdLock(t, configPath+".lock", syscall.LOCK_EX)
+	_, err = s.ReadConfig()
+	require.ErrorIs(t, err, storage.ErrLockTimeout)
+	require.ErrorIs(t, s.WriteConfig([]byte("new contents")), storage.ErrLockTimeout)
+	release()
+
+	// While another process reads, reads succeed and writes do not acquire the lock
+	release = holdLock(t, configPath+".lock", syscall.LOCK_SH)
+	inBytes, err := s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, "old contents", string(inBytes))
+	require.ErrorIs(t, s.WriteConfig([]byte("new contents")), storage.ErrLockTimeout)
+	release()
+
+	require.NoError(t, s.WriteConfig([]byte("new contents")))
+	inBytes, err = s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, "new contents", string(inBytes))
+}
+
+func TestFileStorage_Lock_Wait(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "go-structconf-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	configPath := filepath.Join(tmpDir, "config.json")
+	s := file.NewFileStorage(configPath, 0640)
+
+	// Writes wait for the lock to be released
+	release := holdLock(t, configPath+".lock", syscall.LOCK_EX)
+	time.AfterFunc(100*time.Millisecond, release)
+	require.NoError(t, s.WriteConfig([]byte("new contents")))
+}
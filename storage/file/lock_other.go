@@ -0,0 +1,34 @@
+//go:build !unix || aix || solaris
+
+package file
+
+import (
+	"errors"
+	"os"
+
+	"github.com/anexia-it/go-structconf/storage"
+)
+
+// lock acquires the lock by exclusively creating the lock file, for both reads and writes
+func (fs *fileStorage) lock(exclusive bool) (unlock func(), err error) {
+	path := fs.lockPath()
+	err = acquire(fs.lockTimeout, func() (bool, error) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fs.mode)
+		if os.IsExist(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		return true, f.Close()
+	})
+	if err != nil && !exclusive && !errors.Is(err, storage.ErrLockTimeout) {
+		// Readers without permission to create the lock file read without holding a lock
+		return func() {}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		os.Remove(path)
+	}, nil
+}
@@ -0,0 +1,40 @@
+// Package fsys provides read-only configuration storage for go-structconf backed by an fs.FS,
+// like configuration files embedded using embed.FS
+package fsys
+
+import (
+	"io/fs"
+
+	"github.com/anexia-it/go-structconf/storage"
+)
+
+var _ storage.Storage = (*fsysStorage)(nil)
+
+// fs.FS-based storage implementation
+type fsysStorage struct {
+	fsys fs.FS
+	path string
+}
+
+// WriteConfig returns storage.ErrReadOnly, as fs.FS does not support writing
+func (s *fsysStorage) WriteConfig([]byte) error {
+	return storage.ErrReadOnly
+}
+
+func (s *fsysStorage) ReadConfig() ([]byte, error) {
+	return fs.ReadFile(s.fsys, s.path)
+}
+
+// String returns the path of the file
+func (s *fsysStorage) String() string {
+	return s.path
+}
+
+// NewFSStorage initializes a new read-only configuration storage, which reads the file at path
+// from the passed fs.FS. Paths are slash-separated and unrooted, see fs.ValidPath.
+func NewFSStorage(fsys fs.FS, path string) storage.Storage {
+	return &fsysStorage{
+		fsys: fsys,
+		path: path,
+	}
+}
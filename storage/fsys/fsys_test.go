@@ -0,0 +1,40 @@
+package fsys_test
+
+import (
+	"embed"
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/anexia-it/go-structconf/storage"
+	"github.com/anexia-it/go-structconf/storage/fsys"
+	"github.com/stretchr/testify/require"
+)
+
+//go:embed testdata/config.json
+var testdata embed.FS
+
+func TestFSStorage(t *testing.T) {
+	s := fsys.NewFSStorage(fstest.MapFS{
+		"etc/app/config.yaml": &fstest.MapFile{Data: []byte("name: test\n")},
+	}, "etc/app/config.yaml")
+
+	inBytes, err := s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, "name: test\n", string(inBytes))
+
+	require.ErrorIs(t, s.WriteConfig([]byte("name: changed\n")), storage.ErrReadOnly)
+	require.EqualValues(t, "etc/app/config.yaml", fmt.Sprint(s))
+}
+
+func TestFSStorage_Embed(t *testing.T) {
+	s := fsys.NewFSStorage(testdata, "testdata/config.json")
+
+	inBytes, err := s.ReadConfig()
+	require.NoError(t, err)
+	require.JSONEq(t, `{"name":"embedded"}`, string(inBytes))
+
+	// Missing files are reported as such, so optional sources can be skipped
+	_, err = fsys.NewFSStorage(testdata, "testdata/missing.json").ReadConfig()
+	require.ErrorIs(t, err, storage.ErrNotExist)
+}
@@ -0,0 +1,420 @@
+// Package git provides configuration storage for go-structconf backed by a file in a git repository
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	gitstorage "github.com/go-git/go-git/v5/storage"
+
+	"github.com/anexia-it/go-structconf/storage"
+)
+
+const (
+	// DefaultAuthorName defines the name of the author of commits, unless configured otherwise
+	// using OptionAuthor
+	DefaultAuthorName = "go-structconf"
+
+	// DefaultAuthorEmail defines the email address of the author of commits, unless configured
+	// otherwise using OptionAuthor
+	DefaultAuthorEmail = "go-structconf@localhost"
+
+	// DefaultMessage defines the message of commits, unless configured otherwise using
+	// OptionMessage
+	DefaultMessage = "Update configuration"
+
+	// DefaultPollInterval defines the interval in which Watch checks the repository for changes,
+	// unless configured otherwise using OptionPollInterval
+	DefaultPollInterval = time.Second
+)
+
+var _ storage.Storage = (*gitStorage)(nil)
+var _ storage.Watcher = (*gitStorage)(nil)
+var _ storage.Versioned = (*gitStorage)(nil)
+
+// Option defines the function type of git storage options
+type Option func(*gitStorage)
+
+// OptionBranch configures the branch the configuration is read from and committed to.
+// By default, the branch HEAD refers to is used.
+func OptionBranch(branch string) Option {
+	return func(s *gitStorage) {
+		s.branch = plumbing.NewBranchReferenceName(branch)
+	}
+}
+
+// OptionRevision pins the storage to the given revision, like a tag, a commit hash or any other
+// revision understood by git. Pinned storages are read-only.
+func OptionRevision(revision string) Option {
+	return func(s *gitStorage) {
+		s.revision = revision
+	}
+}
+
+// OptionAuthor configures the author of commits
+func OptionAuthor(name string, email string) Option {
+	return func(s *gitStorage) {
+		s.authorName = name
+		s.authorEmail = email
+	}
+}
+
+// OptionMessage configures the message of commits
+func OptionMessage(message string) Option {
+	return func(s *gitStorage) {
+		s.message = message
+	}
+}
+
+// OptionPush pushes the branch to the given remote after each commit.
+//
+// If pushing fails, the commit is kept in the local repository and pushed along with the next
+// commit. The error is returned along with the version of the commit, see storage.Versioned.
+// Pushing to remotes referred to by a local path requires the git binary.
+func OptionPush(remote string) Option {
+	return func(s *gitStorage) {
+		s.remote = remote
+	}
+}
+
+// OptionPollInterval configures the interval in which Watch checks the repository for changes.
+// Watch fails with storage.ErrInvalidPollInterval unless the interval is positive.
+func OptionPollInterval(interval time.Duration) Option {
+	return func(s *gitStorage) {
+		s.pollInterval = interval
+	}
+}
+
+// git-based storage implementation
+type gitStorage struct {
+	repo         *gogit.Repository
+	path         string
+	branch       plumbing.ReferenceName
+	revision     string
+	authorName   string
+	authorEmail  string
+	message      string
+	remote       string
+	pollInterval time.Duration
+	mutex        sync.Mutex
+}
+
+func (s *gitStorage) WriteConfig(data []byte) error {
+	_, err := s.WriteConfigVersion(data, storage.AnyVersion)
+	return err
+}
+
+// WriteConfigVersion commits the file to the branch, iff the file in the branch's latest commit
+// still matches the expected version. The version is the hash of the file's blob.
+//
+// The commit is created directly in the repository's object database, neither the index nor a
+// checked out working tree are updated. If the branch does not exist yet, it is created.
+func (s *gitStorage) WriteConfigVersion(data []byte, expected storage.Version) (storage.Version, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	branch, err := s.writableBranch()
+	if err != nil {
+		return storage.NoVersion, err
+	}
+
+	head, err := s.repo.Reference(branch, true)
+	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return storage.NoVersion, err
+	}
+
+	var parent *object.Commit
+	if head != nil {
+		if parent, err = s.repo.CommitObject(head.Hash()); err != nil {
+			return storage.NoVersion, err
+		}
+	}
+
+	if expected != storage.AnyVersion {
+		current := storage.NoVersion
+		if parent != nil {
+			if _, current, err = s.readFile(parent); err != nil && !errors.Is(err, storage.ErrNotExist) {
+				return storage.NoVersion, err
+			}
+		}
+		if current != expected {
+			return storage.NoVersion, storage.ErrConflict
+		}
+	}
+
+	blob, err := s.writeBlob(data)
+	if err != nil {
+		return storage.NoVersion, err
+	}
+
+	var tree *object.Tree
+	var parents []plumbing.Hash
+	if parent != nil {
+		if tree, err = parent.Tree(); err != nil {
+			return storage.NoVersion, err
+		}
+		parents = []plumbing.Hash{parent.Hash}
+	}
+
+	treeHash, err := s.writeTree(tree, strings.Split(s.cleanPath(), "/"), blob)
+	if err != nil {
+		return storage.NoVersion, err
+	}
+
+	commit, err := s.writeCommit(treeHash, parents)
+	if err != nil {
+		return storage.NoVersion, err
+	}
+
+	// Only move the branch if nobody else did in the meantime
+	if err := s.repo.Storer.CheckAndSetReference(plumbing.NewHashReference(branch, commit), head); err != nil {
+		if errors.Is(err, gitstorage.ErrReferenceHasChanged) {
+			return storage.NoVersion, storage.ErrConflict
+		}
+		return storage.NoVersion, err
+	}
+
+	version := storage.Version(blob.String())
+	if s.remote != "" {
+		refSpec := config.RefSpec(branch + ":" + branch)
+		err := s.repo.Push(&gogit.PushOptions{RemoteName: s.remote, RefSpecs: []config.RefSpec{refSpec}})
+		if err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
+			// The commit is in place nonetheless, so the next write expects its version
+			return version, fmt.Errorf("push to %s: %w", s.remote, err)
+		}
+	}
+
+	return version, nil
+}
+
+// writableBranch returns the branch configurations are committed to.
+// Storages pinned to a revision and detached HEADs are read-only.
+func (s *gitStorage) writableBranch() (plumbing.ReferenceName, error) {
+	if s.revision != "" {
+		return "", storage.ErrReadOnly
+	} else if s.branch != "" {
+		return s.branch, nil
+	}
+
+	head, err := s.repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return "", err
+	} else if head.Type() != plumbing.SymbolicReference || !head.Target().IsBranch() {
+		return "", fmt.Errorf("detached HEAD: %w", storage.ErrReadOnly)
+	}
+	return head.Target(), nil
+}
+
+// writeBlob stores data as blob object
+func (s *gitStorage) writeBlob(data []byte) (plumbing.Hash, error) {
+	obj := s.repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return plumbing.ZeroHash, err
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return s.repo.Storer.SetEncodedObject(obj)
+}
+
+// writeTree stores a copy of tree, in which the file at the path consisting of parts refers to the
+// given blob. Missing subtrees are created, tree may be nil for an empty tree.
+func (s *gitStorage) writeTree(tree *object.Tree, parts []string, blob plumbing.Hash) (plumbing.Hash, error) {
+	var entries []object.TreeEntry
+	if tree != nil {
+		entries = append(entries, tree.Entries...)
+	}
+
+	index := -1
+	for i, entry := range entries {
+		if entry.Name == parts[0] {
+			index = i
+			break
+		}
+	}
+
+	entry := object.TreeEntry{Name: parts[0], Mode: filemode.Regular, Hash: blob}
+	if len(parts) > 1 {
+		var subtree *object.Tree
+		if index >= 0 && entries[index].Mode == filemode.Dir {
+			var err error
+			if subtree, err = s.repo.TreeObject(entries[index].Hash); err != nil {
+				return plumbing.ZeroHash, err
+			}
+		}
+
+		hash, err := s.writeTree(subtree, parts[1:], blob)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		entry = object.TreeEntry{Name: parts[0], Mode: filemode.Dir, Hash: hash}
+	} else if index >= 0 && entries[index].Mode == filemode.Executable {
+		entry.Mode = filemode.Executable
+	}
+
+	if index >= 0 {
+		entries[index] = entry
+	} else {
+		entries = append(entries, entry)
+	}
+
+	// Git sorts entries by name, with trees being compared as if their name had a trailing slash
+	sort.Slice(entries, func(i, j int) bool {
+		return sortName(entries[i]) < sortName(entries[j])
+	})
+
+	obj := s.repo.Storer.NewEncodedObject()
+	if err := (&object.Tree{Entries: entries}).Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return s.repo.Storer.SetEncodedObject(obj)
+}
+
+// sortName returns the name a tree entry is sorted by
+func sortName(entry object.TreeEntry) string {
+	if entry.Mode == filemode.Dir {
+		return entry.Name + "/"
+	}
+	return entry.Name
+}
+
+// writeCommit stores a commit of the given tree
+func (s *gitStorage) writeCommit(tree plumbing.Hash, parents []plumbing.Hash) (plumbing.Hash, error) {
+	signature := object.Signature{Name: s.authorName, Email: s.authorEmail, When: time.Now()}
+	commit := &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      s.message,
+		TreeHash:     tree,
+		ParentHashes: parents,
+	}
+
+	obj := s.repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return s.repo.Storer.SetEncodedObject(obj)
+}
+
+func (s *gitStorage) ReadConfig() ([]byte, error) {
+	data, _, err := s.ReadConfigVersion()
+	return data, err
+}
+
+// ReadConfigVersion reads the file from the branch's latest commit, or the pinned revision,
+// along with the hash of its blob as version
+func (s *gitStorage) ReadConfigVersion() ([]byte, storage.Version, error) {
+	commit, err := s.commit()
+	if err != nil {
+		return nil, storage.NoVersion, err
+	}
+	return s.readFile(commit)
+}
+
+// commit returns the commit the file is read from
+func (s *gitStorage) commit() (*object.Commit, error) {
+	if s.revision != "" {
+		hash, err := s.repo.ResolveRevision(plumbing.Revision(s.revision))
+		if err != nil {
+			return nil, fmt.Errorf("revision %s: %w", s.revision, err)
+		}
+		return s.repo.CommitObject(*hash)
+	}
+
+	name := s.branch
+	if name == "" {
+		name = plumbing.HEAD
+	}
+
+	ref, err := s.repo.Reference(name, true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		// The branch has no commits yet
+		return nil, fmt.Errorf("%s: %w", name, storage.ErrNotExist)
+	} else if err != nil {
+		return nil, err
+	}
+	return s.repo.CommitObject(ref.Hash())
+}
+
+// readFile reads the file from the given commit
+func (s *gitStorage) readFile(commit *object.Commit) ([]byte, storage.Version, error) {
+	file, err := commit.File(s.cleanPath())
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, storage.NoVersion, fmt.Errorf("%s: %w", s.path, storage.ErrNotExist)
+	} else if err != nil {
+		return nil, storage.NoVersion, err
+	}
+
+	r, err := file.Reader()
+	if err != nil {
+		return nil, storage.NoVersion, err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, storage.NoVersion, err
+	}
+	return data, storage.Version(file.Hash.String()), nil
+}
+
+// cleanPath returns the path of the file relative to the repository's root
+func (s *gitStorage) cleanPath() string {
+	return strings.TrimPrefix(path.Clean("/"+s.path), "/")
+}
+
+// String returns the path of the file along with the branch or revision, if configured
+func (s *gitStorage) String() string {
+	if s.revision != "" {
+		return s.path + "@" + s.revision
+	} else if s.branch != "" {
+		return s.path + "@" + s.branch.Short()
+	}
+	return s.path
+}
+
+// Watch polls the repository for changes of the file, as git does not provide change
+// notifications
+func (s *gitStorage) Watch(ctx context.Context) (<-chan struct{}, error) {
+	return storage.Poll(ctx, s.pollInterval, s.ReadConfig, bytes.Equal)
+}
+
+// NewGitStorage initializes a new configuration storage, which reads the file at the given path
+// from the passed repository and commits each write
+func NewGitStorage(repo *gogit.Repository, path string, options ...Option) storage.Storage {
+	s := &gitStorage{
+		repo:         repo,
+		path:         path,
+		authorName:   DefaultAuthorName,
+		authorEmail:  DefaultAuthorEmail,
+		message:      DefaultMessage,
+		pollInterval: DefaultPollInterval,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
@@ -0,0 +1,232 @@
+package git_test
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/anexia-it/go-structconf/storage"
+	"github.com/anexia-it/go-structconf/storage/git"
+	"github.com/stretchr/testify/require"
+)
+
+// initRepo initializes a bare repository in a temporary directory
+func initRepo(t *testing.T) (*gogit.Repository, string) {
+	dir := t.TempDir()
+	repo, err := gogit.PlainInit(dir, true)
+	require.NoError(t, err)
+	return repo, dir
+}
+
+func TestGitStorage(t *testing.T) {
+	repo, dir := initRepo(t)
+	s := git.NewGitStorage(repo, "config/app.json",
+		git.OptionAuthor("Jane Doe", "jane@example.com"), git.OptionMessage("Update app configuration"))
+
+	// Missing configurations are reported as such, even if the branch has no commits yet
+	_, err := s.ReadConfig()
+	require.ErrorIs(t, err, storage.ErrNotExist)
+
+	require.NoError(t, s.WriteConfig([]byte(`{"test":"first"}`)))
+	require.NoError(t, s.WriteConfig([]byte(`{"test":"second"}`)))
+
+	inBytes, err := s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"second"}`, string(inBytes))
+
+	// Each write is a commit of the configured author
+	head, err := repo.Head()
+	require.NoError(t, err)
+	require.EqualValues(t, "refs/heads/master", head.Name())
+
+	commit, err := repo.CommitObject(head.Hash())
+	require.NoError(t, err)
+	require.EqualValues(t, "Jane Doe", commit.Author.Name)
+	require.EqualValues(t, "jane@example.com", commit.Author.Email)
+	require.EqualValues(t, "Update app configuration", commit.Message)
+	require.Len(t, commit.ParentHashes, 1)
+
+	parent, err := commit.Parent(0)
+	require.NoError(t, err)
+	require.Empty(t, parent.ParentHashes)
+	file, err := parent.File("config/app.json")
+	require.NoError(t, err)
+	contents, err := file.Contents()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"first"}`, contents)
+
+	// Other files of the repository are kept
+	other := git.NewGitStorage(repo, "README")
+	require.NoError(t, other.WriteConfig([]byte("readme")))
+	inBytes, err = s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"second"}`, string(inBytes))
+
+	// The repository is consistent for git itself
+	if _, err := exec.LookPath("git"); err == nil {
+		out, err := exec.Command("git", "-C", dir, "fsck", "--strict").CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	require.EqualValues(t, "config/app.json", fmt.Sprint(s))
+}
+
+func TestGitStorage_Version(t *testing.T) {
+	repo, _ := initRepo(t)
+	s := git.NewGitStorage(repo, "config.json")
+
+	// Writing a new configuration expects it not to exist yet
+	version, err := s.(storage.Versioned).WriteConfigVersion([]byte(`{"test":"first"}`), storage.NoVersion)
+	require.NoError(t, err)
+	require.NotEqualValues(t, storage.NoVersion, version)
+
+	_, err = s.(storage.Versioned).WriteConfigVersion([]byte(`{"test":"other"}`), storage.NoVersion)
+	require.ErrorIs(t, err, storage.ErrConflict)
+
+	inBytes, readVersion, err := s.(storage.Versioned).ReadConfigVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"first"}`, string(inBytes))
+	require.EqualValues(t, version, readVersion)
+
+	// Commits of other files do not change the version
+	require.NoError(t, git.NewGitStorage(repo, "other.json").WriteConfig([]byte(`{}`)))
+
+	version, err = s.(storage.Versioned).WriteConfigVersion([]byte(`{"test":"second"}`), readVersion)
+	require.NoError(t, err)
+	require.NotEqualValues(t, readVersion, version)
+
+	// Writing based on an outdated version fails
+	_, err = s.(storage.Versioned).WriteConfigVersion([]byte(`{"test":"other"}`), readVersion)
+	require.ErrorIs(t, err, storage.ErrConflict)
+
+	inBytes, err = s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"second"}`, string(inBytes))
+}
+
+func TestGitStorage_Revision(t *testing.T) {
+	repo, _ := initRepo(t)
+	s := git.NewGitStorage(repo, "config.json", git.OptionBranch("production"))
+
+	require.NoError(t, s.WriteConfig([]byte(`{"test":"first"}`)))
+	head, err := repo.Reference(plumbing.NewBranchReferenceName("production"), true)
+	require.NoError(t, err)
+	_, err = repo.CreateTag("v1", head.Hash(), nil)
+	require.NoError(t, err)
+	require.NoError(t, s.WriteConfig([]byte(`{"test":"second"}`)))
+
+	// The branch HEAD refers to is left untouched
+	_, err = git.NewGitStorage(repo, "config.json").ReadConfig()
+	require.ErrorIs(t, err, storage.ErrNotExist)
+	require.EqualValues(t, "config.json@production", fmt.Sprint(s))
+
+	for _, revision := range []string{"v1", head.Hash().String(), "production~1"} {
+		pinned := git.NewGitStorage(repo, "config.json", git.OptionRevision(revision))
+		inBytes, err := pinned.ReadConfig()
+		require.NoError(t, err)
+		require.EqualValues(t, `{"test":"first"}`, string(inBytes))
+		require.EqualValues(t, "config.json@"+revision, fmt.Sprint(pinned))
+
+		// Pinned storages are read-only
+		require.ErrorIs(t, pinned.WriteConfig([]byte(`{}`)), storage.ErrReadOnly)
+	}
+
+	_, err = git.NewGitStorage(repo, "config.json", git.OptionRevision("v2")).ReadConfig()
+	require.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+}
+
+func TestGitStorage_Push(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("pushing to local remotes requires the git binary")
+	}
+
+	remote, remoteDir := initRepo(t)
+	repo, _ := initRepo(t)
+	_, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{remoteDir}})
+	require.NoError(t, err)
+
+	s := git.NewGitStorage(repo, "config.json", git.OptionPush("origin"))
+	require.NoError(t, s.WriteConfig([]byte(`{"test":"first"}`)))
+	require.NoError(t, s.WriteConfig([]byte(`{"test":"second"}`)))
+
+	inBytes, err := git.NewGitStorage(remote, "config.json").ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"second"}`, string(inBytes))
+
+	// Failing pushes are reported
+	s = git.NewGitStorage(repo, "config.json", git.OptionPush("missing"))
+	require.ErrorIs(t, s.WriteConfig([]byte(`{}`)), gogit.ErrRemoteNotFound)
+}
+
+func TestGitStorage_PushFailed(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("pushing to local remotes requires the git binary")
+	}
+
+	remoteDir := filepath.Join(t.TempDir(), "remote.git")
+	repo, _ := initRepo(t)
+	_, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{remoteDir}})
+	require.NoError(t, err)
+	s := git.NewGitStorage(repo, "config.json", git.OptionPush("origin")).(storage.Versioned)
+
+	// The remote is unreachable, the commit is kept nonetheless
+	version, err := s.WriteConfigVersion([]byte(`{"test":"first"}`), storage.NoVersion)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "push to origin: ")
+
+	inBytes, current, err := s.ReadConfigVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"first"}`, string(inBytes))
+	require.EqualValues(t, current, version)
+
+	// The next write expects the version of the kept commit and pushes both commits
+	remote, err := gogit.PlainInit(remoteDir, true)
+	require.NoError(t, err)
+	_, err = s.WriteConfigVersion([]byte(`{"test":"second"}`), version)
+	require.NoError(t, err)
+
+	head, err := remote.Reference(plumbing.NewBranchReferenceName("master"), true)
+	require.NoError(t, err)
+	commit, err := remote.CommitObject(head.Hash())
+	require.NoError(t, err)
+	require.Len(t, commit.ParentHashes, 1)
+
+	inBytes, err = git.NewGitStorage(remote, "config.json").ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"second"}`, string(inBytes))
+}
+
+func TestGitStorage_Watch(t *testing.T) {
+	repo, _ := initRepo(t)
+	s := git.NewGitStorage(repo, "config.json", git.OptionPollInterval(10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := s.(storage.Watcher).Watch(ctx)
+	require.NoError(t, err)
+
+	// Commits of other files are not reported
+	require.NoError(t, git.NewGitStorage(repo, "other.json").WriteConfig([]byte(`{}`)))
+	select {
+	case <-changes:
+		t.Fatal("unexpected change notification")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, s.WriteConfig([]byte(`{"test":"written"}`)))
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change notification")
+	}
+
+	cancel()
+	for range changes {
+	}
+}
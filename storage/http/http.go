@@ -0,0 +1,324 @@
+// Package http provides configuration storage for go-structconf backed by an HTTP(S) server
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/anexia-it/go-structconf/storage"
+	"github.com/anexia-it/go-structconf/storage/file"
+)
+
+const (
+	// DefaultTimeout defines the timeout of each request, unless configured otherwise using
+	// OptionTimeout
+	DefaultTimeout = 30 * time.Second
+
+	// DefaultBackoff defines the delay before the first retry, unless configured otherwise using
+	// OptionRetries. The delay is doubled for every further retry.
+	DefaultBackoff = 500 * time.Millisecond
+)
+
+// ErrUnexpectedStatus indicates that the server responded with an unexpected status code
+var ErrUnexpectedStatus = errors.New("Unexpected HTTP status")
+
+var _ storage.Storage = (*httpStorage)(nil)
+var _ storage.Versioned = (*httpStorage)(nil)
+
+// Option defines the function type of HTTP storage options
+type Option func(*httpStorage)
+
+// OptionHeader configures a header sent with every request
+func OptionHeader(key, value string) Option {
+	return func(s *httpStorage) {
+		s.header.Add(key, value)
+	}
+}
+
+// OptionBearerToken configures the token sent for bearer authentication
+func OptionBearerToken(token string) Option {
+	return func(s *httpStorage) {
+		s.header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// OptionTLSConfig configures the TLS configuration used for HTTPS connections.
+// It is ignored if a client is configured using OptionClient.
+func OptionTLSConfig(config *tls.Config) Option {
+	return func(s *httpStorage) {
+		s.tlsConfig = config
+	}
+}
+
+// OptionTimeout configures the timeout of each request, including reading the response body.
+// It is ignored if a client is configured using OptionClient.
+func OptionTimeout(timeout time.Duration) Option {
+	return func(s *httpStorage) {
+		s.timeout = timeout
+	}
+}
+
+// OptionClient configures the client used for sending requests
+func OptionClient(client *nethttp.Client) Option {
+	return func(s *httpStorage) {
+		s.client = client
+	}
+}
+
+// OptionRetries configures how often failed requests are retried and the delay before the first
+// retry, which is doubled for every further retry.
+// Requests are retried if the server is unreachable or responds with a server error or
+// 429 Too Many Requests. This includes writes, so servers accepting writes using POST should
+// handle repeated writes gracefully.
+func OptionRetries(retries int, backoff time.Duration) Option {
+	return func(s *httpStorage) {
+		s.retries = retries
+		s.backoff = backoff
+	}
+}
+
+// OptionWriteMethod configures the method used for writing the configuration, which defaults to PUT
+func OptionWriteMethod(method string) Option {
+	return func(s *httpStorage) {
+		s.writeMethod = method
+	}
+}
+
+// OptionCacheFile configures a file the last configuration read from the server is kept in,
+// so it can be used if the server is unreachable after a restart
+func OptionCacheFile(path string) Option {
+	return func(s *httpStorage) {
+		s.cacheFile = file.NewFileStorage(path, 0600)
+	}
+}
+
+// HTTP-based storage implementation
+type httpStorage struct {
+	url         string
+	header      nethttp.Header
+	client      *nethttp.Client
+	tlsConfig   *tls.Config
+	timeout     time.Duration
+	retries     int
+	backoff     time.Duration
+	writeMethod string
+	cacheFile   storage.Storage
+
+	// cache holds the last configuration read from the server along with its ETag
+	cache     []byte
+	cacheETag string
+	mutex     sync.Mutex
+}
+
+func (s *httpStorage) ReadConfig() ([]byte, error) {
+	data, _, err := s.ReadConfigVersion()
+	return data, err
+}
+
+// ReadConfigVersion requests the configuration, using its ETag as version.
+//
+// If the configuration has been read before, the request is conditional, so the server can
+// respond with 304 Not Modified instead of sending the configuration again.
+// If the server is unreachable or responds with a server error, the last configuration read is
+// returned. The ETag of the configuration kept in the cache file is not known, so it is reported
+// with storage.UnknownVersion, which makes conditional writes fail with storage.ErrConflict.
+// If the server responds with 404 Not Found, storage.ErrNotExist is returned.
+func (s *httpStorage) ReadConfigVersion() ([]byte, storage.Version, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	header := nethttp.Header{}
+	if s.cache != nil && s.cacheETag != "" {
+		header.Set("If-None-Match", s.cacheETag)
+	}
+
+	resp, body, err := s.do(nethttp.MethodGet, header, nil)
+	if err != nil || resp.StatusCode >= 500 {
+		if cached, cachedVersion, ok := s.cached(); ok {
+			return cached, cachedVersion, nil
+		} else if err != nil {
+			return nil, storage.NoVersion, err
+		}
+	}
+
+	switch {
+	case resp.StatusCode == nethttp.StatusNotModified:
+		return append([]byte{}, s.cache...), version(s.cacheETag), nil
+	case resp.StatusCode == nethttp.StatusNotFound:
+		return nil, storage.NoVersion, fmt.Errorf("%s: %w", resp.Status, storage.ErrNotExist)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return nil, storage.NoVersion, fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+	}
+
+	s.cache = body
+	s.cacheETag = resp.Header.Get("ETag")
+	if s.cacheFile != nil {
+		if err := s.cacheFile.WriteConfig(body); err != nil {
+			return nil, storage.NoVersion, fmt.Errorf("cache file: %w", err)
+		}
+	}
+
+	return append([]byte{}, body...), version(s.cacheETag), nil
+}
+
+func (s *httpStorage) WriteConfig(data []byte) error {
+	_, err := s.WriteConfigVersion(data, storage.AnyVersion)
+	return err
+}
+
+// WriteConfigVersion sends the configuration, using the If-Match header to make the write
+// conditional on the expected ETag. If the server responds with 412 Precondition Failed,
+// storage.ErrConflict is returned.
+func (s *httpStorage) WriteConfigVersion(data []byte, expected storage.Version) (storage.Version, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	header := nethttp.Header{}
+	switch expected {
+	case storage.UnknownVersion:
+		return storage.NoVersion, storage.ErrConflict
+	case storage.AnyVersion:
+	case storage.NoVersion:
+		header.Set("If-None-Match", "*")
+	default:
+		header.Set("If-Match", string(expected))
+	}
+
+	resp, _, err := s.do(s.writeMethod, header, data)
+	if err != nil {
+		return storage.NoVersion, err
+	} else if resp.StatusCode == nethttp.StatusPreconditionFailed {
+		return storage.NoVersion, storage.ErrConflict
+	} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return storage.NoVersion, fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+	}
+
+	// The written configuration is the current one, as far as this storage knows
+	s.cache = append([]byte{}, data...)
+	s.cacheETag = resp.Header.Get("ETag")
+	return version(s.cacheETag), nil
+}
+
+// String returns the URL, with the password redacted
+func (s *httpStorage) String() string {
+	if u, err := url.Parse(s.url); err == nil {
+		return u.Redacted()
+	}
+	return s.url
+}
+
+// do sends a request, retrying it if the server is unreachable or responds with a server error,
+// and returns the response along with its body
+func (s *httpStorage) do(method string, header nethttp.Header, data []byte) (resp *nethttp.Response, body []byte, err error) {
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		resp, body, err = s.send(method, header, data)
+		if !retryable(resp, err) || attempt >= s.retries {
+			return
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// send sends a single request and reads the response body
+func (s *httpStorage) send(method string, header nethttp.Header, data []byte) (*nethttp.Response, []byte, error) {
+	var reqBody io.Reader
+	if data != nil {
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := nethttp.NewRequestWithContext(context.Background(), method, s.url, reqBody)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for key, values := range s.header {
+		req.Header[key] = values
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, body, nil
+}
+
+// cached returns the last configuration read along with its version, either from memory or
+// the cache file
+func (s *httpStorage) cached() ([]byte, storage.Version, bool) {
+	if s.cache != nil {
+		return append([]byte{}, s.cache...), version(s.cacheETag), true
+	}
+
+	if s.cacheFile != nil {
+		if data, err := s.cacheFile.ReadConfig(); err == nil {
+			return data, storage.UnknownVersion, true
+		}
+	}
+	return nil, storage.NoVersion, false
+}
+
+// retryable checks if a request should be retried
+func retryable(resp *nethttp.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == nethttp.StatusTooManyRequests
+}
+
+// version returns the storage version for the given ETag. Without ETag, writes cannot be
+// conditional, so storage.AnyVersion is returned.
+func version(etag string) storage.Version {
+	if etag == "" {
+		return storage.AnyVersion
+	}
+	return storage.Version(etag)
+}
+
+// NewHTTPStorage initializes a new configuration storage, which reads the configuration from the
+// given URL using GET requests and writes it using PUT requests
+func NewHTTPStorage(url string, options ...Option) storage.Storage {
+	s := &httpStorage{
+		url:         url,
+		header:      nethttp.Header{},
+		timeout:     DefaultTimeout,
+		backoff:     DefaultBackoff,
+		writeMethod: nethttp.MethodPut,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	if s.client == nil {
+		transport := nethttp.DefaultTransport.(*nethttp.Transport).Clone()
+		if s.tlsConfig != nil {
+			transport.TLSClientConfig = s.tlsConfig
+		}
+		s.client = &nethttp.Client{
+			Transport: transport,
+			Timeout:   s.timeout,
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,221 @@
+// Package memory provides in-memory configuration storage for go-structconf, intended for tests
+// and programmatically built configurations
+package memory
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/anexia-it/go-structconf/storage"
+)
+
+var _ storage.Storage = (*Storage)(nil)
+var _ storage.Watcher = (*Storage)(nil)
+var _ storage.Versioned = (*Storage)(nil)
+
+// Option defines the function type of memory storage options
+type Option func(*Storage)
+
+// OptionData pre-seeds the storage with the passed configuration bytes
+func OptionData(data []byte) Option {
+	return func(s *Storage) {
+		s.data = copyBytes(data)
+		s.exists = true
+	}
+}
+
+// Storage holds the configuration bytes in memory. It is safe for concurrent use.
+//
+// Until data is written, reads return storage.ErrNotExist.
+// Every write increments the version reported through the storage.Versioned interface.
+type Storage struct {
+	data    []byte
+	exists  bool
+	version uint64
+
+	reads  int
+	writes int
+
+	readErr  error
+	writeErr error
+
+	watchers []chan struct{}
+	mutex    sync.Mutex
+}
+
+// WriteConfig stores a copy of the configuration bytes
+func (s *Storage) WriteConfig(data []byte) error {
+	_, err := s.WriteConfigVersion(data, storage.AnyVersion)
+	return err
+}
+
+// ReadConfig returns a copy of the stored configuration bytes
+func (s *Storage) ReadConfig() ([]byte, error) {
+	data, _, err := s.ReadConfigVersion()
+	return data, err
+}
+
+// ReadConfigVersion returns a copy of the stored configuration bytes along with their version
+func (s *Storage) ReadConfigVersion() ([]byte, storage.Version, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.reads++
+	if err := s.readErr; err != nil {
+		s.readErr = nil
+		return nil, storage.NoVersion, err
+	}
+
+	if !s.exists {
+		return nil, storage.NoVersion, storage.ErrNotExist
+	}
+	return copyBytes(s.data), s.currentVersion(), nil
+}
+
+// WriteConfigVersion stores a copy of the configuration bytes, iff the stored version matches the
+// expected version
+func (s *Storage) WriteConfigVersion(data []byte, expected storage.Version) (storage.Version, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.writes++
+	if err := s.writeErr; err != nil {
+		s.writeErr = nil
+		return storage.NoVersion, err
+	}
+
+	if expected != storage.AnyVersion && expected != s.currentVersion() {
+		return storage.NoVersion, storage.ErrConflict
+	}
+
+	s.set(data)
+	return s.currentVersion(), nil
+}
+
+// Watch reports every change of the stored configuration
+func (s *Storage) Watch(ctx context.Context) (<-chan struct{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	changes := make(chan struct{}, 1)
+	s.watchers = append(s.watchers, changes)
+
+	go func() {
+		<-ctx.Done()
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		for i, watcher := range s.watchers {
+			if watcher == changes {
+				s.watchers = append(s.watchers[:i], s.watchers[i+1:]...)
+				break
+			}
+		}
+		close(changes)
+	}()
+
+	return changes, nil
+}
+
+// String returns "memory"
+func (s *Storage) String() string {
+	return "memory"
+}
+
+// Data returns a copy of the stored configuration bytes, like the data written by
+// Configuration.Save. If nothing has been stored, false is returned.
+// Unlike ReadConfig, Data neither counts as read nor fails due to an error injected using
+// FailNextRead.
+func (s *Storage) Data() ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return copyBytes(s.data), s.exists
+}
+
+// Set replaces the stored configuration bytes, like another process changing the configuration
+// would. Unlike WriteConfig, Set neither counts as write nor fails due to an error injected using
+// FailNextWrite.
+func (s *Storage) Set(data []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.set(data)
+}
+
+// Reads returns the number of reads performed using ReadConfig and ReadConfigVersion
+func (s *Storage) Reads() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.reads
+}
+
+// Writes returns the number of writes performed using WriteConfig and WriteConfigVersion
+func (s *Storage) Writes() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.writes
+}
+
+// FailNextRead makes the next read return the passed error
+func (s *Storage) FailNextRead(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.readErr = err
+}
+
+// FailNextWrite makes the next write return the passed error, without changing the stored
+// configuration
+func (s *Storage) FailNextWrite(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.writeErr = err
+}
+
+// set stores a copy of data and informs watchers. The mutex must be held.
+func (s *Storage) set(data []byte) {
+	s.data = copyBytes(data)
+	s.exists = true
+	s.version++
+
+	for _, watcher := range s.watchers {
+		// Coalesce changes not yet received
+		select {
+		case watcher <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// currentVersion returns the version of the stored configuration. The mutex must be held.
+func (s *Storage) currentVersion() storage.Version {
+	if !s.exists {
+		return storage.NoVersion
+	}
+	return storage.Version(strconv.FormatUint(s.version, 10))
+}
+
+// copyBytes returns a copy of data, so callers cannot modify the stored configuration
+func copyBytes(data []byte) []byte {
+	if data == nil {
+		return nil
+	}
+	return append([]byte{}, data...)
+}
+
+// NewMemoryStorage initializes a new in-memory configuration storage
+func NewMemoryStorage(options ...Option) *Storage {
+	s := &Storage{}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
@@ -0,0 +1,131 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/anexia-it/go-structconf/storage"
+	"github.com/anexia-it/go-structconf/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	s := memory.NewMemoryStorage()
+
+	// Nothing is stored initially
+	_, err := s.ReadConfig()
+	require.ErrorIs(t, err, storage.ErrNotExist)
+	_, ok := s.Data()
+	require.False(t, ok)
+
+	written := []byte("test contents")
+	require.NoError(t, s.WriteConfig(written))
+
+	// Modifying the written or read slices does not modify the stored configuration
+	written[0] = 'T'
+	inBytes, err := s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, "test contents", string(inBytes))
+	inBytes[0] = 'T'
+
+	data, ok := s.Data()
+	require.True(t, ok)
+	require.EqualValues(t, "test contents", string(data))
+
+	require.EqualValues(t, 2, s.Reads())
+	require.EqualValues(t, 1, s.Writes())
+	require.EqualValues(t, "memory", fmt.Sprint(s))
+}
+
+func TestMemoryStorage_Data(t *testing.T) {
+	s := memory.NewMemoryStorage(memory.OptionData([]byte("seeded")))
+
+	inBytes, err := s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, "seeded", string(inBytes))
+
+	s.Set([]byte("changed"))
+	inBytes, err = s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, "changed", string(inBytes))
+
+	// Set does not count as write
+	require.EqualValues(t, 0, s.Writes())
+}
+
+func TestMemoryStorage_Fail(t *testing.T) {
+	s := memory.NewMemoryStorage(memory.OptionData([]byte("seeded")))
+	testErr := errors.New("test error")
+
+	// Injected errors are returned once
+	s.FailNextRead(testErr)
+	_, err := s.ReadConfig()
+	require.ErrorIs(t, err, testErr)
+	_, err = s.ReadConfig()
+	require.NoError(t, err)
+
+	s.FailNextWrite(testErr)
+	require.ErrorIs(t, s.WriteConfig([]byte("failed")), testErr)
+	require.NoError(t, s.WriteConfig([]byte("written")))
+
+	// Failed writes do not change the stored configuration
+	data, _ := s.Data()
+	require.EqualValues(t, "written", string(data))
+
+	require.EqualValues(t, 2, s.Reads())
+	require.EqualValues(t, 2, s.Writes())
+}
+
+func TestMemoryStorage_Versioned(t *testing.T) {
+	s := memory.NewMemoryStorage()
+
+	version, err := s.WriteConfigVersion([]byte("first"), storage.NoVersion)
+	require.NoError(t, err)
+	_, err = s.WriteConfigVersion([]byte("second"), storage.NoVersion)
+	require.ErrorIs(t, err, storage.ErrConflict)
+
+	data, readVersion, err := s.ReadConfigVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, "first", string(data))
+	require.EqualValues(t, version, readVersion)
+
+	// Changes by others change the version
+	s.Set([]byte("other"))
+	_, err = s.WriteConfigVersion([]byte("second"), version)
+	require.ErrorIs(t, err, storage.ErrConflict)
+}
+
+func TestMemoryStorage_Watch(t *testing.T) {
+	s := memory.NewMemoryStorage()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := s.Watch(ctx)
+	require.NoError(t, err)
+
+	s.Set([]byte("changed"))
+	select {
+	case _, ok := <-changes:
+		require.True(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Change not reported")
+	}
+
+	// Cancelling the context closes the channel
+	cancel()
+	require.Eventually(t, func() bool {
+		select {
+		case _, ok := <-changes:
+			return !ok
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Changes after cancellation do not block
+	s.Set([]byte("changed again"))
+}
@@ -0,0 +1,195 @@
+// Package redis provides configuration storage for go-structconf backed by Redis
+package redis
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/anexia-it/go-structconf/storage"
+)
+
+// DefaultTimeout defines the timeout of each operation, unless configured otherwise using
+// OptionTimeout
+const DefaultTimeout = 5 * time.Second
+
+var _ storage.Storage = (*redisStorage)(nil)
+var _ storage.Watcher = (*redisStorage)(nil)
+var _ storage.Versioned = (*redisStorage)(nil)
+
+// Option defines the function type of Redis storage options
+type Option func(*redisStorage)
+
+// OptionHashField stores the configuration in the given field of a hash stored at the key,
+// instead of storing it as the key's string value
+func OptionHashField(field string) Option {
+	return func(s *redisStorage) {
+		s.field = field
+	}
+}
+
+// OptionChannel configures the channel changes are published to, which defaults to the key
+func OptionChannel(channel string) Option {
+	return func(s *redisStorage) {
+		s.channel = channel
+	}
+}
+
+// OptionTimeout configures the timeout of each operation
+func OptionTimeout(timeout time.Duration) Option {
+	return func(s *redisStorage) {
+		s.timeout = timeout
+	}
+}
+
+// Redis-based storage implementation
+type redisStorage struct {
+	client  goredis.UniversalClient
+	key     string
+	field   string
+	channel string
+	timeout time.Duration
+}
+
+func (s *redisStorage) WriteConfig(data []byte) error {
+	_, err := s.WriteConfigVersion(data, storage.AnyVersion)
+	return err
+}
+
+func (s *redisStorage) ReadConfig() ([]byte, error) {
+	data, _, err := s.ReadConfigVersion()
+	return data, err
+}
+
+// ReadConfigVersion reads the configuration, using a hash of it as version
+func (s *redisStorage) ReadConfigVersion() ([]byte, storage.Version, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	return s.get(ctx, s.client)
+}
+
+// WriteConfigVersion writes the configuration in a transaction, which is only executed if the
+// hash of the stored configuration matches the expected version and the key is not modified
+// concurrently. The new version is published to the channel within the same transaction.
+func (s *redisStorage) WriteConfigVersion(data []byte, expected storage.Version) (storage.Version, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	version := hashVersion(data)
+	err := s.client.Watch(ctx, func(tx *goredis.Tx) error {
+		if expected != storage.AnyVersion {
+			_, current, err := s.get(ctx, tx)
+			if err != nil && !errors.Is(err, storage.ErrNotExist) {
+				return err
+			} else if current != expected {
+				return storage.ErrConflict
+			}
+		}
+
+		_, err := tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			if s.field != "" {
+				pipe.HSet(ctx, s.key, s.field, data)
+			} else {
+				pipe.Set(ctx, s.key, data, 0)
+			}
+			pipe.Publish(ctx, s.channel, string(version))
+			return nil
+		})
+		return err
+	}, s.key)
+
+	if errors.Is(err, goredis.TxFailedErr) {
+		// The key has been modified concurrently
+		return storage.NoVersion, storage.ErrConflict
+	} else if err != nil {
+		return storage.NoVersion, err
+	}
+	return version, nil
+}
+
+// Watch subscribes to the channel changes are published to
+func (s *redisStorage) Watch(ctx context.Context) (<-chan struct{}, error) {
+	pubsub := s.client.Subscribe(ctx, s.channel)
+
+	// Wait for the subscription to be confirmed, so no changes are missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-messages:
+				if !ok {
+					return
+				}
+				storage.Notify(changes)
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// String returns the key, including the hash field if configured
+func (s *redisStorage) String() string {
+	if s.field != "" {
+		return fmt.Sprintf("%s[%s]", s.key, s.field)
+	}
+	return s.key
+}
+
+// get reads the configuration and determines its version
+func (s *redisStorage) get(ctx context.Context, client goredis.Cmdable) ([]byte, storage.Version, error) {
+	var data []byte
+	var err error
+	if s.field != "" {
+		data, err = client.HGet(ctx, s.key, s.field).Bytes()
+	} else {
+		data, err = client.Get(ctx, s.key).Bytes()
+	}
+
+	if errors.Is(err, goredis.Nil) {
+		return nil, storage.NoVersion, fmt.Errorf("%s: %w", s, storage.ErrNotExist)
+	} else if err != nil {
+		return nil, storage.NoVersion, err
+	}
+	return data, hashVersion(data), nil
+}
+
+// hashVersion returns the storage version of the given configuration bytes
+func hashVersion(data []byte) storage.Version {
+	return storage.Version(fmt.Sprintf("%x", sha256.Sum256(data)))
+}
+
+// NewRedisStorage initializes a new configuration storage, which stores the configuration at the
+// given key using the passed Redis client.
+// Every write publishes the new version to a channel, which Watch subscribes to. This allows all
+// instances using the same key to reload once the configuration has been changed by one of them.
+func NewRedisStorage(client goredis.UniversalClient, key string, options ...Option) storage.Storage {
+	s := &redisStorage{
+		client:  client,
+		key:     key,
+		channel: key,
+		timeout: DefaultTimeout,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
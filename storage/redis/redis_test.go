@@ -0,0 +1,125 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/anexia-it/go-structconf/storage"
+	"github.com/anexia-it/go-structconf/storage/redis"
+	"github.com/stretchr/testify/require"
+)
+
+// startRedis starts an in-process Redis server and returns a client connected to it
+func startRedis(t *testing.T) (*goredis.Client, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: server.Addr()})
+	t.Cleanup(func() {
+		client.Close()
+	})
+	return client, server
+}
+
+func TestRedisStorage(t *testing.T) {
+	client, server := startRedis(t)
+	s := redis.NewRedisStorage(client, "app:config")
+
+	// Missing keys are reported as such
+	_, err := s.ReadConfig()
+	require.ErrorIs(t, err, storage.ErrNotExist)
+
+	require.NoError(t, s.WriteConfig([]byte(`{"test":"written"}`)))
+	inBytes, err := s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"written"}`, string(inBytes))
+
+	value, err := server.Get("app:config")
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"written"}`, value)
+
+	require.EqualValues(t, "app:config", fmt.Sprint(s))
+}
+
+func TestRedisStorage_HashField(t *testing.T) {
+	client, server := startRedis(t)
+	s := redis.NewRedisStorage(client, "app", redis.OptionHashField("config"))
+
+	_, err := s.ReadConfig()
+	require.ErrorIs(t, err, storage.ErrNotExist)
+
+	require.NoError(t, s.WriteConfig([]byte(`{"test":"written"}`)))
+	require.EqualValues(t, `{"test":"written"}`, server.HGet("app", "config"))
+
+	inBytes, err := s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"written"}`, string(inBytes))
+
+	require.EqualValues(t, "app[config]", fmt.Sprint(s))
+}
+
+func TestRedisStorage_Versioned(t *testing.T) {
+	client, server := startRedis(t)
+	s := redis.NewRedisStorage(client, "app:config").(storage.Versioned)
+
+	version, err := s.WriteConfigVersion([]byte("first"), storage.NoVersion)
+	require.NoError(t, err)
+	_, err = s.WriteConfigVersion([]byte("second"), storage.NoVersion)
+	require.ErrorIs(t, err, storage.ErrConflict)
+
+	data, readVersion, err := s.ReadConfigVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, "first", string(data))
+	require.EqualValues(t, version, readVersion)
+
+	// Changes by others change the version
+	require.NoError(t, server.Set("app:config", "other"))
+	_, err = s.WriteConfigVersion([]byte("second"), version)
+	require.ErrorIs(t, err, storage.ErrConflict)
+
+	_, err = s.WriteConfigVersion([]byte("second"), storage.AnyVersion)
+	require.NoError(t, err)
+}
+
+func TestRedisStorage_Watch(t *testing.T) {
+	client, _ := startRedis(t)
+	s := redis.NewRedisStorage(client, "app:config")
+	other := redis.NewRedisStorage(client, "app:other")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := s.(storage.Watcher).Watch(ctx)
+	require.NoError(t, err)
+
+	// Writes to other keys must not be reported
+	require.NoError(t, other.WriteConfig([]byte("other")))
+	select {
+	case <-changes:
+		t.Fatal("Change of unrelated key reported")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Writes of other instances are reported
+	require.NoError(t, redis.NewRedisStorage(client, "app:config").WriteConfig([]byte("changed")))
+	select {
+	case _, ok := <-changes:
+		require.True(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Change of key not reported")
+	}
+
+	// Cancelling the context closes the channel
+	cancel()
+	require.Eventually(t, func() bool {
+		select {
+		case _, ok := <-changes:
+			return !ok
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+}
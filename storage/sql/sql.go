@@ -0,0 +1,306 @@
+// Package sql provides configuration storage for go-structconf backed by a database/sql database,
+// keeping the history of all written configurations
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anexia-it/go-structconf/storage"
+)
+
+const (
+	// DefaultTable defines the name of the table the configurations are stored in, unless
+	// configured otherwise using OptionTable
+	DefaultTable = "structconf_configs"
+
+	// DefaultTimeout defines the timeout of each operation, unless configured otherwise using
+	// OptionTimeout
+	DefaultTimeout = 5 * time.Second
+)
+
+// Placeholder defines the style of the placeholders in queries, which depends on the database
+type Placeholder int
+
+const (
+	// PlaceholderQuestion uses question marks as placeholders, as used by SQLite and MySQL
+	PlaceholderQuestion Placeholder = iota
+
+	// PlaceholderDollar uses numbered placeholders like $1, as used by PostgreSQL
+	PlaceholderDollar
+)
+
+var _ storage.Storage = (*Storage)(nil)
+var _ storage.Versioned = (*Storage)(nil)
+
+// Option defines the function type of SQL storage options
+type Option func(*Storage)
+
+// OptionTable configures the name of the table the configurations are stored in
+func OptionTable(table string) Option {
+	return func(s *Storage) {
+		s.table = table
+	}
+}
+
+// OptionPlaceholder configures the style of the placeholders in queries
+func OptionPlaceholder(placeholder Placeholder) Option {
+	return func(s *Storage) {
+		s.placeholder = placeholder
+	}
+}
+
+// OptionAuthor configures the author recorded for written configurations
+func OptionAuthor(author string) Option {
+	return func(s *Storage) {
+		s.author = author
+	}
+}
+
+// OptionVersion pins the storage to the given historical version, so reads return that version
+// instead of the latest one. Writes still add a new version.
+//
+// Reads report the latest version number, so saving a configuration loaded from the pinned version,
+// like to roll back to it, only fails with storage.ErrConflict if a version has been added meanwhile.
+func OptionVersion(version int64) Option {
+	return func(s *Storage) {
+		s.version = version
+	}
+}
+
+// OptionTimeout configures the timeout of each operation
+func OptionTimeout(timeout time.Duration) Option {
+	return func(s *Storage) {
+		s.timeout = timeout
+	}
+}
+
+// Revision describes a version of a configuration
+type Revision struct {
+	Version   int64
+	CreatedAt time.Time
+	Author    string
+}
+
+// Storage stores every written configuration as a new row, identified by the name of the
+// configuration and an incrementing version number.
+// Reads return the latest version, unless pinned to a version using OptionVersion.
+//
+// The table needs to be created beforehand, see CreateTable.
+type Storage struct {
+	db          *dbsql.DB
+	name        string
+	table       string
+	placeholder Placeholder
+	author      string
+	version     int64
+	timeout     time.Duration
+}
+
+func (s *Storage) WriteConfig(data []byte) error {
+	_, err := s.WriteConfigVersion(data, storage.AnyVersion)
+	return err
+}
+
+func (s *Storage) ReadConfig() ([]byte, error) {
+	data, _, err := s.ReadConfigVersion()
+	return data, err
+}
+
+// ReadConfigVersion reads the latest configuration along with its version number.
+// If the storage is pinned to a version, that version is read instead, along with the latest
+// version number, which writes expect.
+func (s *Storage) ReadConfigVersion() ([]byte, storage.Version, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	if s.version != 0 {
+		var data string
+		var latest int64
+		err := s.db.QueryRowContext(ctx, s.query(
+			"SELECT data, (SELECT MAX(version) FROM %[1]s WHERE name = ?) FROM %[1]s WHERE name = ? AND version = ?"),
+			s.name, s.name, s.version).Scan(&data, &latest)
+		if errors.Is(err, dbsql.ErrNoRows) {
+			return nil, storage.NoVersion, fmt.Errorf("configuration %s version %d: %w", s.name, s.version, storage.ErrNotExist)
+		} else if err != nil {
+			return nil, storage.NoVersion, err
+		}
+		return []byte(data), numberVersion(latest), nil
+	}
+
+	var data string
+	var version int64
+	err := s.db.QueryRowContext(ctx, s.query(
+		"SELECT data, version FROM %s WHERE name = ? ORDER BY version DESC LIMIT 1"), s.name).
+		Scan(&data, &version)
+	if errors.Is(err, dbsql.ErrNoRows) {
+		return nil, storage.NoVersion, fmt.Errorf("configuration %s: %w", s.name, storage.ErrNotExist)
+	} else if err != nil {
+		return nil, storage.NoVersion, err
+	}
+
+	return []byte(data), numberVersion(version), nil
+}
+
+// WriteConfigVersion adds a new version of the configuration, iff the latest version matches the
+// expected version
+func (s *Storage) WriteConfigVersion(data []byte, expected storage.Version) (storage.Version, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return storage.NoVersion, err
+	}
+	// Rolling back after committing is a no-op
+	defer tx.Rollback()
+
+	var latest dbsql.NullInt64
+	if err := tx.QueryRowContext(ctx, s.query("SELECT MAX(version) FROM %s WHERE name = ?"), s.name).
+		Scan(&latest); err != nil {
+		return storage.NoVersion, err
+	}
+
+	current := storage.NoVersion
+	if latest.Valid {
+		current = numberVersion(latest.Int64)
+	}
+	if expected != storage.AnyVersion && expected != current {
+		return storage.NoVersion, storage.ErrConflict
+	}
+
+	version := latest.Int64 + 1
+	if _, err := tx.ExecContext(ctx, s.query(
+		"INSERT INTO %s (name, version, data, created_at, author) VALUES (?, ?, ?, ?, ?)"),
+		s.name, version, string(data), time.Now().UTC(), s.author); err != nil {
+		tx.Rollback()
+		return storage.NoVersion, s.conflict(ctx, version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return storage.NoVersion, s.conflict(ctx, version, err)
+	}
+	return numberVersion(version), nil
+}
+
+// conflict returns storage.ErrConflict if another writer added the given version concurrently,
+// otherwise err is returned.
+// Depending on the database, concurrent writes are rejected by the primary key or fail due to
+// serialization errors, both of which are reported as driver specific errors.
+func (s *Storage) conflict(ctx context.Context, version int64, err error) error {
+	var latest dbsql.NullInt64
+	if s.db.QueryRowContext(ctx, s.query("SELECT MAX(version) FROM %s WHERE name = ?"), s.name).
+		Scan(&latest) == nil && latest.Int64 >= version {
+		return storage.ErrConflict
+	}
+	return err
+}
+
+// ReadConfigAt reads the given version of the configuration
+func (s *Storage) ReadConfigAt(version int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var data string
+	err := s.db.QueryRowContext(ctx, s.query("SELECT data FROM %s WHERE name = ? AND version = ?"),
+		s.name, version).Scan(&data)
+	if errors.Is(err, dbsql.ErrNoRows) {
+		return nil, fmt.Errorf("configuration %s version %d: %w", s.name, version, storage.ErrNotExist)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return []byte(data), nil
+}
+
+// History returns all versions of the configuration, latest version first
+func (s *Storage) History() ([]Revision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, s.query(
+		"SELECT version, created_at, author FROM %s WHERE name = ? ORDER BY version DESC"), s.name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []Revision
+	for rows.Next() {
+		var revision Revision
+		if err := rows.Scan(&revision.Version, &revision.CreatedAt, &revision.Author); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+// String returns the name of the configuration, along with the pinned version if configured
+func (s *Storage) String() string {
+	if s.version != 0 {
+		return fmt.Sprintf("%s@%d", s.name, s.version)
+	}
+	return s.name
+}
+
+// query inserts the table name into the query and converts its placeholders
+func (s *Storage) query(query string) string {
+	query = fmt.Sprintf(query, s.table)
+	if s.placeholder != PlaceholderDollar {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// numberVersion returns the storage version for the given version number
+func numberVersion(version int64) storage.Version {
+	return storage.Version(strconv.FormatInt(version, 10))
+}
+
+// CreateTable creates the table configurations are stored in, unless it exists already
+func CreateTable(ctx context.Context, db *dbsql.DB, table string) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	name VARCHAR(255) NOT NULL,
+	version INTEGER NOT NULL,
+	data TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	author VARCHAR(255) NOT NULL,
+	PRIMARY KEY (name, version)
+)`, table))
+	return err
+}
+
+// NewSQLStorage initializes a new configuration storage, which stores the configuration of the
+// given name in the passed database
+func NewSQLStorage(db *dbsql.DB, name string, options ...Option) *Storage {
+	s := &Storage{
+		db:      db,
+		name:    name,
+		table:   DefaultTable,
+		timeout: DefaultTimeout,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
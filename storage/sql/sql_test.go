@@ -0,0 +1,270 @@
+package sql_test
+
+import (
+	"context"
+	dbsql "database/sql"
+	"database/sql/driver"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"modernc.org/sqlite"
+
+	"github.com/anexia-it/go-structconf"
+	"github.com/anexia-it/go-structconf/encoding/json"
+	"github.com/anexia-it/go-structconf/storage"
+	"github.com/anexia-it/go-structconf/storage/sql"
+	"github.com/stretchr/testify/require"
+)
+
+// openDB opens a SQLite database in a temporary directory and creates the configuration table
+func openDB(t *testing.T) *dbsql.DB {
+	db, err := dbsql.Open("sqlite", filepath.Join(t.TempDir(), "config.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	require.NoError(t, sql.CreateTable(context.Background(), db, sql.DefaultTable))
+	// Creating the table again is a no-op
+	require.NoError(t, sql.CreateTable(context.Background(), db, sql.DefaultTable))
+	return db
+}
+
+func TestSQLStorage(t *testing.T) {
+	db := openDB(t)
+	s := sql.NewSQLStorage(db, "app")
+
+	// Missing configurations are reported as such
+	_, err := s.ReadConfig()
+	require.ErrorIs(t, err, storage.ErrNotExist)
+
+	require.NoError(t, s.WriteConfig([]byte(`{"test":"first"}`)))
+	require.NoError(t, s.WriteConfig([]byte(`{"test":"second"}`)))
+
+	inBytes, err := s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"second"}`, string(inBytes))
+
+	// Configurations of other names are kept apart
+	other := sql.NewSQLStorage(db, "other")
+	_, err = other.ReadConfig()
+	require.ErrorIs(t, err, storage.ErrNotExist)
+
+	require.EqualValues(t, "app", fmt.Sprint(s))
+}
+
+func TestSQLStorage_Version(t *testing.T) {
+	s := sql.NewSQLStorage(openDB(t), "app")
+
+	// Writing a new configuration expects it not to exist yet
+	version, err := s.WriteConfigVersion([]byte(`{"test":"first"}`), storage.NoVersion)
+	require.NoError(t, err)
+	require.EqualValues(t, "1", version)
+
+	_, err = s.WriteConfigVersion([]byte(`{"test":"other"}`), storage.NoVersion)
+	require.ErrorIs(t, err, storage.ErrConflict)
+
+	inBytes, readVersion, err := s.ReadConfigVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"first"}`, string(inBytes))
+	require.EqualValues(t, version, readVersion)
+
+	version, err = s.WriteConfigVersion([]byte(`{"test":"second"}`), readVersion)
+	require.NoError(t, err)
+	require.EqualValues(t, "2", version)
+
+	// Writing based on an outdated version fails
+	_, err = s.WriteConfigVersion([]byte(`{"test":"other"}`), readVersion)
+	require.ErrorIs(t, err, storage.ErrConflict)
+
+	inBytes, err = s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"second"}`, string(inBytes))
+}
+
+func TestSQLStorage_History(t *testing.T) {
+	db := openDB(t)
+	alice := sql.NewSQLStorage(db, "app", sql.OptionAuthor("alice"))
+	bob := sql.NewSQLStorage(db, "app", sql.OptionAuthor("bob"))
+
+	before := time.Now().Add(-time.Second)
+	require.NoError(t, alice.WriteConfig([]byte(`{"test":"first"}`)))
+	require.NoError(t, bob.WriteConfig([]byte(`{"test":"second"}`)))
+
+	revisions, err := alice.History()
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+	require.EqualValues(t, 2, revisions[0].Version)
+	require.EqualValues(t, "bob", revisions[0].Author)
+	require.EqualValues(t, 1, revisions[1].Version)
+	require.EqualValues(t, "alice", revisions[1].Author)
+	for _, revision := range revisions {
+		require.True(t, revision.CreatedAt.After(before))
+	}
+
+	inBytes, err := alice.ReadConfigAt(1)
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"first"}`, string(inBytes))
+
+	_, err = alice.ReadConfigAt(3)
+	require.ErrorIs(t, err, storage.ErrNotExist)
+
+	// Pinning a missing version reports no version
+	_, version, err := sql.NewSQLStorage(db, "app", sql.OptionVersion(3)).ReadConfigVersion()
+	require.ErrorIs(t, err, storage.ErrNotExist)
+	require.EqualValues(t, storage.NoVersion, version)
+
+	// Pinned storages read the given version, but report the latest one
+	pinned := sql.NewSQLStorage(db, "app", sql.OptionVersion(1))
+	inBytes, version, err = pinned.ReadConfigVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"first"}`, string(inBytes))
+	require.EqualValues(t, "2", version)
+	require.EqualValues(t, "app@1", fmt.Sprint(pinned))
+
+	// Restoring a version adds it as a new version
+	require.NoError(t, alice.WriteConfig(inBytes))
+	inBytes, version, err = alice.ReadConfigVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"first"}`, string(inBytes))
+	require.EqualValues(t, "3", version)
+}
+
+type testConfig struct {
+	Test string `config:"test"`
+}
+
+func TestSQLStorage_Rollback(t *testing.T) {
+	db := openDB(t)
+	latest := sql.NewSQLStorage(db, "app")
+	require.NoError(t, latest.WriteConfig([]byte(`{"test":"first"}`)))
+	require.NoError(t, latest.WriteConfig([]byte(`{"test":"second"}`)))
+
+	encoding, err := json.NewJSONEncoding()
+	require.NoError(t, err)
+
+	// Saving a configuration loaded from a pinned version rolls back to it
+	conf := &testConfig{}
+	c, err := structconf.NewConfiguration(conf,
+		structconf.OptionStorage(sql.NewSQLStorage(db, "app", sql.OptionVersion(1))),
+		structconf.OptionEncoding(encoding))
+	require.NoError(t, err)
+	require.NoError(t, c.Load())
+	require.EqualValues(t, "first", conf.Test)
+	require.NoError(t, c.Save())
+
+	inBytes, version, err := latest.ReadConfigVersion()
+	require.NoError(t, err)
+	require.JSONEq(t, `{"test":"first"}`, string(inBytes))
+	require.EqualValues(t, "3", version)
+
+	// Versions added after loading still make saving conflict
+	require.NoError(t, c.Load())
+	require.NoError(t, latest.WriteConfig([]byte(`{"test":"third"}`)))
+	require.ErrorIs(t, c.Save(), structconf.ErrConflict)
+
+	inBytes, err = latest.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"third"}`, string(inBytes))
+}
+
+func TestSQLStorage_Table(t *testing.T) {
+	db := openDB(t)
+	require.NoError(t, sql.CreateTable(context.Background(), db, "custom_configs"))
+
+	// SQLite also understands numbered placeholders
+	s := sql.NewSQLStorage(db, "app", sql.OptionTable("custom_configs"),
+		sql.OptionPlaceholder(sql.PlaceholderDollar))
+	require.NoError(t, s.WriteConfig([]byte(`{"test":"written"}`)))
+
+	inBytes, err := s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"written"}`, string(inBytes))
+
+	// The default table is left untouched
+	_, err = sql.NewSQLStorage(db, "app").ReadConfig()
+	require.ErrorIs(t, err, storage.ErrNotExist)
+}
+
+// beforeInsert is called by the connections of the racing driver before executing inserts
+var beforeInsert func()
+
+func init() {
+	dbsql.Register("sqlite-racing", racingDriver{})
+}
+
+// racingDriver wraps the SQLite driver, calling beforeInsert before executing inserts
+type racingDriver struct{}
+
+func (racingDriver) Open(name string) (driver.Conn, error) {
+	conn, err := (&sqlite.Driver{}).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return racingConn{conn}, nil
+}
+
+type racingConn struct {
+	driver.Conn
+}
+
+func (c racingConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.Prepare(query)
+	if err != nil || !strings.HasPrefix(query, "INSERT") {
+		return stmt, err
+	}
+	return racingStmt{stmt}, nil
+}
+
+type racingStmt struct {
+	driver.Stmt
+}
+
+func (s racingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if beforeInsert != nil {
+		beforeInsert()
+	}
+	return s.Stmt.Exec(args)
+}
+
+func TestSQLStorage_ConcurrentWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.db")
+
+	// Write-ahead logging allows another connection to commit while the storage is reading
+	db, err := dbsql.Open("sqlite", path+"?_pragma=journal_mode(WAL)")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+	})
+	require.NoError(t, sql.CreateTable(context.Background(), db, sql.DefaultTable))
+
+	racingDB, err := dbsql.Open("sqlite-racing", path+"?_pragma=journal_mode(WAL)")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		racingDB.Close()
+	})
+
+	other := sql.NewSQLStorage(db, "app", sql.OptionAuthor("other"))
+	s := sql.NewSQLStorage(racingDB, "app")
+
+	// Another writer adds the same version between determining the latest version and inserting
+	beforeInsert = func() {
+		beforeInsert = nil
+		require.NoError(t, other.WriteConfig([]byte(`{"test":"other"}`)))
+	}
+	t.Cleanup(func() {
+		beforeInsert = nil
+	})
+
+	require.ErrorIs(t, s.WriteConfig([]byte(`{"test":"written"}`)), storage.ErrConflict)
+
+	inBytes, err := s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"other"}`, string(inBytes))
+
+	// Without concurrent writers, writing succeeds again
+	require.NoError(t, s.WriteConfig([]byte(`{"test":"written"}`)))
+}
@@ -1,6 +1,56 @@
 // Package storage provides common functionality for go-structconf storages
 package storage
 
+import (
+	"context"
+	"errors"
+	"io/fs"
+)
+
+var (
+	// ErrWatchNotSupported indicates that a storage is not able to report changes
+	ErrWatchNotSupported = errors.New("Storage does not support watching for changes")
+
+	// ErrNotExist indicates that no configuration is stored.
+	// Storages return this error, possibly wrapped, from ReadConfig. Errors of the os package
+	// signalling missing files match this error when compared using errors.Is.
+	ErrNotExist = fs.ErrNotExist
+
+	// ErrLockTimeout indicates that a storage could not acquire the lock protecting the stored
+	// configuration from concurrent access by other processes in time
+	ErrLockTimeout = errors.New("Timed out waiting for the storage lock")
+
+	// ErrConflict indicates that the stored configuration has been changed since it was read
+	ErrConflict = errors.New("Stored configuration has been changed")
+
+	// ErrReadOnly indicates that a storage does not support writing the configuration
+	ErrReadOnly = errors.New("Storage is read-only")
+
+	// ErrMultipleDocuments indicates that a storage holds multiple configuration documents,
+	// which need to be read using ReadConfigs
+	ErrMultipleDocuments = errors.New("Storage holds multiple documents")
+
+	// ErrVersionNotSupported indicates that a storage is not able to report versions
+	ErrVersionNotSupported = errors.New("Storage does not support versions")
+)
+
+// Version identifies a state of the stored configuration, like a hash of the data or the revision
+// of a key in a key-value store.
+// Versions are opaque tokens, which are only compared for equality.
+type Version string
+
+const (
+	// NoVersion is the version of a configuration which does not exist
+	NoVersion Version = ""
+
+	// AnyVersion makes WriteConfigVersion write the configuration regardless of the stored version
+	AnyVersion Version = "*"
+
+	// UnknownVersion is reported if the configuration was read from a fallback, like a cache, while
+	// the version of the stored configuration is unknown. Writes expecting it fail with ErrConflict.
+	UnknownVersion Version = "unknown"
+)
+
 // Storage defines the interface configuration storages implement
 type Storage interface {
 	// WriteConfig writes the configuration bytes to the storage
@@ -8,3 +58,44 @@ type Storage interface {
 	// ReadConfig reads the configuration bytes from the storage
 	ReadConfig() ([]byte, error)
 }
+
+// Watcher defines the interface storages implement if they are able to report
+// changes of the stored configuration
+type Watcher interface {
+	// Watch starts observing the storage and sends a value on the returned channel
+	// every time the stored configuration may have changed.
+	// The channel is closed once the passed context is done.
+	Watch(ctx context.Context) (<-chan struct{}, error)
+}
+
+// Versioned defines the interface storages implement if they are able to report the version of
+// the stored configuration and to write it conditionally.
+// Storages wrapping other storages return ErrVersionNotSupported if the wrapped storage
+// does not support versions.
+type Versioned interface {
+	// ReadConfigVersion reads the configuration bytes along with their version
+	ReadConfigVersion() ([]byte, Version, error)
+	// WriteConfigVersion writes the configuration bytes, iff the version of the stored configuration
+	// still matches the expected version, and returns the new version.
+	// If the version does not match, ErrConflict is returned.
+	// Storages writing to multiple backends, which wrote the configuration but failed to write
+	// some of the backends, return the new version along with the error.
+	WriteConfigVersion(data []byte, expected Version) (Version, error)
+}
+
+// Document represents one of the configuration documents held by a MultiDocument storage
+type Document struct {
+	// Name identifies the document, like the path of the file it was read from
+	Name string
+	// Data holds the configuration bytes of the document
+	Data []byte
+}
+
+// MultiDocument defines the interface storages implement if the configuration consists of
+// multiple documents, like the files of a drop-in directory.
+// Such storages return ErrMultipleDocuments from ReadConfig.
+type MultiDocument interface {
+	// ReadConfigs reads all documents. The documents are applied in the returned order, with
+	// values of later documents taking precedence.
+	ReadConfigs() ([]Document, error)
+}
@@ -0,0 +1,300 @@
+// Package tee provides a storage decorator for go-structconf, which writes the configuration to
+// multiple storages, like while migrating from one storage to another
+package tee
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/anexia-it/go-structconf/storage"
+)
+
+// ErrDivergence indicates that the configuration of a secondary storage differs from the
+// configuration of the primary storage
+var ErrDivergence = errors.New("Configuration diverges from primary storage")
+
+// WriteMode defines how failing writes to secondary storages are handled
+type WriteMode int
+
+const (
+	// WriteAll requires the writes to all storages to succeed
+	WriteAll WriteMode = iota
+
+	// WriteBestEffort only requires the write to the primary storage to succeed.
+	// Failing writes to secondary storages are passed to the error handler, see OptionErrorHandler.
+	WriteBestEffort
+)
+
+// ReadMode defines which storages the configuration is read from
+type ReadMode int
+
+const (
+	// ReadPrimary reads the configuration from the primary storage only
+	ReadPrimary ReadMode = iota
+
+	// ReadCompare reads the configuration from all storages and reports secondary storages whose
+	// configuration differs from the primary storage's configuration as ErrDivergence to the
+	// error handler, see OptionErrorHandler. The primary storage's configuration is returned.
+	ReadCompare
+)
+
+var _ storage.Storage = (*Storage)(nil)
+var _ storage.Watcher = (*Storage)(nil)
+var _ storage.Versioned = (*Storage)(nil)
+
+// Option defines the function type of tee storage options
+type Option func(*Storage)
+
+// OptionWriteMode configures how failing writes to secondary storages are handled
+func OptionWriteMode(mode WriteMode) Option {
+	return func(s *Storage) {
+		s.writeMode = mode
+	}
+}
+
+// OptionParallel writes to the secondary storages concurrently instead of one after another
+func OptionParallel() Option {
+	return func(s *Storage) {
+		s.parallel = true
+	}
+}
+
+// OptionReadMode configures which storages the configuration is read from
+func OptionReadMode(mode ReadMode) Option {
+	return func(s *Storage) {
+		s.readMode = mode
+	}
+}
+
+// OptionErrorHandler configures the handler of errors which do not fail reads or writes, like
+// failing writes to secondary storages with WriteBestEffort and divergences detected with
+// ReadCompare
+func OptionErrorHandler(handler func(error)) Option {
+	return func(s *Storage) {
+		s.errorHandler = handler
+	}
+}
+
+// Storage wraps multiple storages, the first one being the primary storage.
+//
+// Writes go to the primary storage first. Only if that succeeds, the secondary storages are
+// written, how failures are handled depends on the WriteMode. Reads are served by the
+// primary storage.
+type Storage struct {
+	storages     []storage.Storage
+	writeMode    WriteMode
+	parallel     bool
+	readMode     ReadMode
+	errorHandler func(error)
+}
+
+// WriteConfig writes the configuration to the primary storage, then to the secondary storages.
+// With WriteAll, the errors of all failing secondary storages are returned as *multierror.Error.
+func (s *Storage) WriteConfig(data []byte) error {
+	primary, err := s.primary()
+	if err != nil {
+		return err
+	}
+
+	if err := primary.WriteConfig(data); err != nil {
+		return err
+	}
+
+	return s.writeSecondaries(data)
+}
+
+// ReadConfig reads the configuration from the primary storage, see ReadMode
+func (s *Storage) ReadConfig() ([]byte, error) {
+	primary, err := s.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := primary.ReadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	s.compare(data)
+	return data, nil
+}
+
+// ReadConfigVersion reads the configuration along with its version from the primary storage.
+// If the primary storage does not implement storage.Versioned, storage.ErrVersionNotSupported
+// is returned.
+func (s *Storage) ReadConfigVersion() ([]byte, storage.Version, error) {
+	versioned, err := s.versionedPrimary()
+	if err != nil {
+		return nil, storage.NoVersion, err
+	}
+
+	data, version, err := versioned.ReadConfigVersion()
+	if err != nil {
+		return nil, storage.NoVersion, err
+	}
+
+	s.compare(data)
+	return data, version, nil
+}
+
+// WriteConfigVersion writes the configuration like WriteConfig, iff the version of the primary
+// storage's configuration matches the expected version. Secondary storages are written without
+// checking their version. If writing secondary storages fails, the new version of the primary
+// storage is returned along with the error.
+// If the primary storage does not implement storage.Versioned, storage.ErrVersionNotSupported
+// is returned.
+func (s *Storage) WriteConfigVersion(data []byte, expected storage.Version) (storage.Version, error) {
+	versioned, err := s.versionedPrimary()
+	if err != nil {
+		return storage.NoVersion, err
+	}
+
+	version, err := versioned.WriteConfigVersion(data, expected)
+	if err != nil {
+		return storage.NoVersion, err
+	}
+
+	return version, s.writeSecondaries(data)
+}
+
+// writeSecondaries writes the configuration to the secondary storages, see WriteMode
+func (s *Storage) writeSecondaries(data []byte) error {
+	errs := make([]error, len(s.storages))
+	if s.parallel {
+		var wg sync.WaitGroup
+		for i := 1; i < len(s.storages); i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = s.storages[i].WriteConfig(data)
+			}(i)
+		}
+		wg.Wait()
+	} else {
+		for i := 1; i < len(s.storages); i++ {
+			errs[i] = s.storages[i].WriteConfig(data)
+		}
+	}
+
+	var result error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		err = multierror.Prefix(err, describe(i, s.storages[i])+":")
+		if s.writeMode == WriteBestEffort {
+			s.handleError(err)
+			continue
+		}
+		result = multierror.Append(result, err)
+	}
+
+	return result
+}
+
+// compare reads the configuration of the secondary storages and reports divergences from the
+// primary storage's configuration, if enabled using ReadCompare
+func (s *Storage) compare(data []byte) {
+	if s.readMode != ReadCompare {
+		return
+	}
+
+	for i := 1; i < len(s.storages); i++ {
+		secondary, err := s.storages[i].ReadConfig()
+		if err == nil && !bytes.Equal(data, secondary) {
+			err = ErrDivergence
+		}
+
+		if err != nil {
+			s.handleError(fmt.Errorf("%s: %w", describe(i, s.storages[i]), err))
+		}
+	}
+}
+
+// handleError passes err to the error handler, if configured
+func (s *Storage) handleError(err error) {
+	if s.errorHandler != nil {
+		s.errorHandler(err)
+	}
+}
+
+// primary returns the primary storage.
+// Tees without storages are read-only.
+func (s *Storage) primary() (storage.Storage, error) {
+	if len(s.storages) == 0 {
+		return nil, storage.ErrReadOnly
+	}
+	return s.storages[0], nil
+}
+
+// versionedPrimary returns the primary storage, if it implements storage.Versioned
+func (s *Storage) versionedPrimary() (storage.Versioned, error) {
+	primary, err := s.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	versioned, ok := primary.(storage.Versioned)
+	if !ok {
+		return nil, storage.ErrVersionNotSupported
+	}
+	return versioned, nil
+}
+
+// Watch observes the primary storage.
+// If the primary storage does not implement storage.Watcher, storage.ErrWatchNotSupported
+// is returned.
+func (s *Storage) Watch(ctx context.Context) (<-chan struct{}, error) {
+	primary, err := s.primary()
+	if err != nil {
+		return nil, storage.ErrWatchNotSupported
+	}
+
+	watcher, ok := primary.(storage.Watcher)
+	if !ok {
+		return nil, storage.ErrWatchNotSupported
+	}
+	return watcher.Watch(ctx)
+}
+
+// String returns the description of the primary storage, if it implements fmt.Stringer
+func (s *Storage) String() string {
+	if len(s.storages) == 0 {
+		return ""
+	}
+
+	if stringer, ok := s.storages[0].(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return ""
+}
+
+// describe returns the description of the i-th storage used in errors
+func describe(i int, member storage.Storage) string {
+	if stringer, ok := member.(fmt.Stringer); ok {
+		if description := stringer.String(); description != "" {
+			return fmt.Sprintf("storage %d (%s)", i+1, description)
+		}
+	}
+	return fmt.Sprintf("storage %d", i+1)
+}
+
+// NewTeeStorage wraps the passed storages.
+// The first storage is the primary storage, which the configuration is read from.
+func NewTeeStorage(storages []storage.Storage, options ...Option) *Storage {
+	s := &Storage{
+		storages: storages,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
@@ -0,0 +1,195 @@
+package tee_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/anexia-it/go-structconf/storage"
+	"github.com/anexia-it/go-structconf/storage/fsys"
+	"github.com/anexia-it/go-structconf/storage/memory"
+	"github.com/anexia-it/go-structconf/storage/tee"
+	"github.com/stretchr/testify/require"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+// errorCollector collects the errors passed to the error handler
+type errorCollector struct {
+	errs  []error
+	mutex sync.Mutex
+}
+
+func (c *errorCollector) handle(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.errs = append(c.errs, err)
+}
+
+func (c *errorCollector) collected() []error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]error(nil), c.errs...)
+}
+
+func TestTeeStorage(t *testing.T) {
+	for name, options := range map[string][]tee.Option{
+		"sequential": nil,
+		"parallel":   {tee.OptionParallel()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			primary := memory.NewMemoryStorage()
+			secondaries := []*memory.Storage{memory.NewMemoryStorage(), memory.NewMemoryStorage()}
+			s := tee.NewTeeStorage([]storage.Storage{primary, secondaries[0], secondaries[1]}, options...)
+
+			require.NoError(t, s.WriteConfig([]byte(`{"test":"written"}`)))
+			for _, member := range append([]*memory.Storage{primary}, secondaries...) {
+				written, ok := member.Data()
+				require.True(t, ok)
+				require.EqualValues(t, `{"test":"written"}`, string(written))
+			}
+
+			// Reads are served by the primary storage
+			secondaries[0].Set([]byte(`{"test":"diverged"}`))
+			inBytes, err := s.ReadConfig()
+			require.NoError(t, err)
+			require.EqualValues(t, `{"test":"written"}`, string(inBytes))
+			require.EqualValues(t, 0, secondaries[0].Reads())
+
+			// All writes need to succeed
+			secondaries[0].FailNextWrite(errUnavailable)
+			secondaries[1].FailNextWrite(errUnavailable)
+			err = s.WriteConfig([]byte(`{"test":"failed"}`))
+			require.ErrorIs(t, err, errUnavailable)
+
+			multiErr, ok := err.(*multierror.Error)
+			require.True(t, ok, "Returned error is not a multierror.Error")
+			require.Len(t, multiErr.Errors, 2)
+			require.Contains(t, multiErr.Errors[0].Error(), "storage 2 (memory): ")
+			require.Contains(t, multiErr.Errors[1].Error(), "storage 3 (memory): ")
+
+			// Secondary storages are not written if the primary storage fails
+			primary.FailNextWrite(errUnavailable)
+			require.ErrorIs(t, s.WriteConfig([]byte(`{"test":"primary failed"}`)), errUnavailable)
+			written, _ := secondaries[1].Data()
+			require.EqualValues(t, `{"test":"written"}`, string(written))
+
+			require.EqualValues(t, "memory", fmt.Sprint(s))
+		})
+	}
+}
+
+func TestTeeStorage_BestEffort(t *testing.T) {
+	primary := memory.NewMemoryStorage()
+	secondary := memory.NewMemoryStorage()
+	errs := &errorCollector{}
+	s := tee.NewTeeStorage([]storage.Storage{primary, secondary},
+		tee.OptionWriteMode(tee.WriteBestEffort), tee.OptionErrorHandler(errs.handle))
+
+	// Failing secondary storages are reported to the error handler only
+	secondary.FailNextWrite(errUnavailable)
+	require.NoError(t, s.WriteConfig([]byte(`{"test":"written"}`)))
+	written, _ := primary.Data()
+	require.EqualValues(t, `{"test":"written"}`, string(written))
+
+	require.Len(t, errs.collected(), 1)
+	require.ErrorIs(t, errs.collected()[0], errUnavailable)
+
+	// The primary storage still needs to succeed
+	primary.FailNextWrite(errUnavailable)
+	require.ErrorIs(t, s.WriteConfig([]byte(`{"test":"failed"}`)), errUnavailable)
+}
+
+func TestTeeStorage_Compare(t *testing.T) {
+	primary := memory.NewMemoryStorage(memory.OptionData([]byte(`{"test":"primary"}`)))
+	secondary := memory.NewMemoryStorage(memory.OptionData([]byte(`{"test":"primary"}`)))
+	errs := &errorCollector{}
+	s := tee.NewTeeStorage([]storage.Storage{primary, secondary},
+		tee.OptionReadMode(tee.ReadCompare), tee.OptionErrorHandler(errs.handle))
+
+	inBytes, err := s.ReadConfig()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"primary"}`, string(inBytes))
+	require.Empty(t, errs.collected())
+
+	// Divergences are reported, the primary storage's configuration is returned nonetheless
+	secondary.Set([]byte(`{"test":"diverged"}`))
+	inBytes, _, err = s.ReadConfigVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"test":"primary"}`, string(inBytes))
+	require.Len(t, errs.collected(), 1)
+	require.ErrorIs(t, errs.collected()[0], tee.ErrDivergence)
+	require.Contains(t, errs.collected()[0].Error(), "storage 2 (memory): ")
+
+	// Failing secondary storages are reported as well
+	secondary.FailNextRead(errUnavailable)
+	_, err = s.ReadConfig()
+	require.NoError(t, err)
+	require.Len(t, errs.collected(), 2)
+	require.ErrorIs(t, errs.collected()[1], errUnavailable)
+}
+
+func TestTeeStorage_Version(t *testing.T) {
+	primary := memory.NewMemoryStorage(memory.OptionData([]byte(`{"test":"primary"}`)))
+	secondary := memory.NewMemoryStorage()
+	s := tee.NewTeeStorage([]storage.Storage{primary, secondary})
+
+	_, version, err := s.ReadConfigVersion()
+	require.NoError(t, err)
+
+	version, err = s.WriteConfigVersion([]byte(`{"test":"first"}`), version)
+	require.NoError(t, err)
+	written, _ := secondary.Data()
+	require.EqualValues(t, `{"test":"first"}`, string(written))
+
+	// Conflicting writes do not touch the secondary storages
+	_, err = s.WriteConfigVersion([]byte(`{"test":"conflict"}`), storage.NoVersion)
+	require.ErrorIs(t, err, storage.ErrConflict)
+	written, _ = secondary.Data()
+	require.EqualValues(t, `{"test":"first"}`, string(written))
+
+	// Partially failed writes report the new version of the primary storage
+	secondary.FailNextWrite(errUnavailable)
+	newVersion, err := s.WriteConfigVersion([]byte(`{"test":"second"}`), version)
+	require.ErrorIs(t, err, errUnavailable)
+	_, current, err := primary.ReadConfigVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, current, newVersion)
+
+	// Primary storages without version support are reported as such
+	s = tee.NewTeeStorage([]storage.Storage{fsys.NewFSStorage(fstest.MapFS{}, "config.json"), secondary})
+	_, _, err = s.ReadConfigVersion()
+	require.ErrorIs(t, err, storage.ErrVersionNotSupported)
+	_, err = s.WriteConfigVersion([]byte(`{}`), storage.AnyVersion)
+	require.ErrorIs(t, err, storage.ErrVersionNotSupported)
+}
+
+func TestTeeStorage_Watch(t *testing.T) {
+	primary := memory.NewMemoryStorage()
+	s := tee.NewTeeStorage([]storage.Storage{primary, memory.NewMemoryStorage()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := s.Watch(ctx)
+	require.NoError(t, err)
+
+	primary.Set([]byte(`{"test":"changed"}`))
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change notification")
+	}
+
+	cancel()
+	for range changes {
+	}
+
+	s = tee.NewTeeStorage([]storage.Storage{fsys.NewFSStorage(fstest.MapFS{}, "config.json")})
+	_, err = s.Watch(context.Background())
+	require.ErrorIs(t, err, storage.ErrWatchNotSupported)
+}
@@ -0,0 +1,13 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+)
+
+// FileVersion returns the version of a file holding the given data, consisting of the file's
+// modification time, its size and a hash of the data
+func FileVersion(info fs.FileInfo, data []byte) Version {
+	return Version(fmt.Sprintf("%d-%d-%x", info.ModTime().UnixNano(), info.Size(), sha256.Sum256(data)))
+}
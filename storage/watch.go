@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrInvalidPollInterval indicates that a storage polling for changes was configured with an
+// interval which is not positive
+var ErrInvalidPollInterval = errors.New("Poll interval must be positive")
+
+// Notify sends a change notification on the channel without blocking.
+// If a notification is already pending, the changes are coalesced.
+func Notify(changes chan<- struct{}) {
+	select {
+	case changes <- struct{}{}:
+	default:
+	}
+}
+
+// Poll implements Watch for storages which are not able to report changes, by calling read in the
+// given interval and reporting a change whenever the result differs from the previous one.
+// Missing configurations are treated like the zero value. If read fails, a change is reported
+// once, so the consumer runs into the error on its next read.
+// The returned channel is closed once the passed context is done.
+func Poll[T any](ctx context.Context, interval time.Duration, read func() (T, error),
+	equal func(a, b T) bool) (<-chan struct{}, error) {
+	if interval <= 0 {
+		return nil, ErrInvalidPollInterval
+	}
+
+	poll := func() (T, error) {
+		result, err := read()
+		if errors.Is(err, ErrNotExist) {
+			var zero T
+			return zero, nil
+		}
+		return result, err
+	}
+
+	// Remember the current result, so only actual changes are reported
+	last, err := poll()
+	if err != nil {
+		return nil, err
+	}
+	failing := false
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current, readErr := poll()
+			if readErr != nil {
+				// Report the first failure only, the consumer runs into the error on its next read
+				if !failing {
+					failing = true
+					Notify(changes)
+				}
+				continue
+			}
+
+			if failing || !equal(last, current) {
+				failing = false
+				last = current
+				Notify(changes)
+			}
+		}
+	}()
+
+	return changes, nil
+}
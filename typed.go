@@ -0,0 +1,52 @@
+package structconf
+
+import (
+	"reflect"
+	"sync/atomic"
+)
+
+// Typed wraps a Configuration of the struct type T and provides lock-free access to it.
+//
+// Every time a change is applied by Load, SetDefaults or Overlay, a new instance of T is built and
+// published atomically. Readers retrieve the current instance using Get and never block or observe
+// partially applied changes. The instances returned by Get are shared and must not be modified.
+//
+// The instances only hold the values of fields handled by the mapper, private fields and fields
+// ignored using the "-" tag value are left at their zero-value.
+type Typed[T any] struct {
+	*Configuration
+
+	current atomic.Pointer[T]
+}
+
+// Get returns the current configuration
+func (t *Typed[T]) Get() *T {
+	return t.current.Load()
+}
+
+// optionCommitHook configures the function called every time a change has been applied
+func optionCommitHook(hook func(scratch reflect.Value)) Option {
+	return func(c *Configuration) error {
+		c.commitHook = hook
+		return nil
+	}
+}
+
+// NewTyped initializes a new typed configuration of the struct type T with the given options
+func NewTyped[T any](options ...Option) (*Typed[T], error) {
+	t := &Typed[T]{}
+	t.current.Store(new(T))
+
+	// The hook is configured first, so defaults configured using OptionDefaults are published as well
+	options = append([]Option{optionCommitHook(func(scratch reflect.Value) {
+		t.current.Store(scratch.Interface().(*T))
+	})}, options...)
+
+	c, err := NewConfiguration(new(T), options...)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Configuration = c
+	return t, nil
+}
@@ -0,0 +1,92 @@
+package structconf
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/anexia-it/go-structconf/storage/aferofile"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTyped(t *testing.T) {
+	// Only struct types are supported
+	typed, err := NewTyped[string]()
+	require.EqualError(t, err, ErrNotAStructPointer.Error())
+	require.Nil(t, typed)
+
+	// Without defaults, the zero-value is returned
+	conf, err := NewTyped[TestConfigEnv]()
+	require.NoError(t, err)
+	require.NotNil(t, conf.Get())
+	require.EqualValues(t, TestConfigEnv{}, *conf.Get())
+
+	// Defaults are published on initialization
+	conf, err = NewTyped[TestConfigEnv](OptionDefaults(&TestConfigEnv{Name: "default"}))
+	require.NoError(t, err)
+	require.EqualValues(t, "default", conf.Get().Name)
+}
+
+func TestTyped_Get(t *testing.T) {
+	enc := newTestEncodings(t)
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/config.json",
+		[]byte(`{"name":"loaded","database":{"host":"db"}}`), 0640))
+
+	conf, err := NewTyped[TestConfigEnv](
+		OptionStorage(aferofile.NewAferoFileStorage(fs, "/config.json", 0640)),
+		OptionEncoding(enc.json),
+		OptionDefaults(&TestConfigEnv{Name: "default", Tags: []string{"a"}}))
+	require.NoError(t, err)
+
+	defaults := conf.Get()
+	require.NoError(t, conf.Load())
+
+	// Load publishes a new snapshot and leaves the previous one untouched
+	loaded := conf.Get()
+	require.NotSame(t, defaults, loaded)
+	require.EqualValues(t, "default", defaults.Name)
+	require.EqualValues(t, "loaded", loaded.Name)
+	require.EqualValues(t, "db", loaded.Database.Host)
+	require.EqualValues(t, []string{"a"}, loaded.Tags)
+
+	// Failed loads do not publish a snapshot
+	require.NoError(t, afero.WriteFile(fs, "/config.json", []byte(`{"name":`), 0640))
+	require.Error(t, conf.Load())
+	require.Same(t, loaded, conf.Get())
+
+	// Overlays publish a new snapshot as well
+	require.NoError(t, conf.Overlay("test", map[string]interface{}{"name": "overlay"}))
+	require.EqualValues(t, "overlay", conf.Get().Name)
+	require.EqualValues(t, "loaded", loaded.Name)
+}
+
+func TestTyped_Get_Concurrent(t *testing.T) {
+	conf, err := NewTyped[TestConfigSimple]()
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					_ = conf.Get().Test
+				}
+			}
+		}()
+	}
+
+	for _, value := range []string{"a", "b", "c"} {
+		require.NoError(t, conf.Overlay("test", map[string]interface{}{"test": value}))
+		require.EqualValues(t, value, conf.Get().Test)
+	}
+
+	close(done)
+	wg.Wait()
+}
@@ -7,6 +7,19 @@ import (
 	"github.com/hashicorp/go-multierror"
 )
 
+// MergeStrategy defines which values take precedence when merging
+type MergeStrategy int
+
+const (
+	// MergeNonZero lets values from the "b" map take precedence, iff they are not zero-values.
+	// This is the strategy used by MergeMaps and MergeValues.
+	MergeNonZero MergeStrategy = iota
+
+	// MergePresent lets values from the "b" map take precedence whenever they are present,
+	// even if they are zero-values. Only nil values are treated as not being set.
+	MergePresent
+)
+
 // MergeMaps merges the passed maps
 // The resulting map contains all keys that existed in either of the passed maps.
 // For keys that exist in both maps, the value from the "b" map takes precedence,
@@ -14,7 +27,13 @@ import (
 // Keys that are present in both maps are expected to be of the same type. If this is not the case,
 // an error will be returned.
 func MergeMaps(a, b map[string]interface{}) (map[string]interface{}, error) {
-	merged, err := mergeMaps(reflect.ValueOf(a), reflect.ValueOf(b))
+	return MergeMapsWithStrategy(a, b, MergeNonZero)
+}
+
+// MergeMapsWithStrategy merges the passed maps like MergeMaps, using the given strategy
+// to decide if values from the "b" map take precedence
+func MergeMapsWithStrategy(a, b map[string]interface{}, strategy MergeStrategy) (map[string]interface{}, error) {
+	merged, err := mergeMaps(reflect.ValueOf(a), reflect.ValueOf(b), strategy)
 	if err != nil {
 		return nil, err
 	}
@@ -53,6 +72,12 @@ func isMergeUnsupportedKind(k reflect.Kind) error {
 // - If both values are non-zero and slices or arrays, return b
 // - If both values are non-zero and maps, merge each element of the map using the above logic
 func MergeValues(a, b interface{}) (interface{}, error) {
+	return mergeValues(a, b, MergeNonZero)
+}
+
+// mergeValues merges two values using the given strategy.
+// With MergePresent, zero-values of b are treated like any other value.
+func mergeValues(a, b interface{}, strategy MergeStrategy) (interface{}, error) {
 	// Simple case: a is nil
 	if a == nil {
 		return b, nil
@@ -66,19 +91,19 @@ func MergeValues(a, b interface{}) (interface{}, error) {
 	valueB := reflect.ValueOf(b)
 
 	// Simple case: b is zero
-	if reflect.DeepEqual(b, reflect.Zero(valueB.Type()).Interface()) {
+	if strategy == MergeNonZero && reflect.DeepEqual(b, reflect.Zero(valueB.Type()).Interface()) {
 		return a, nil
 	}
 
 	valueA := reflect.ValueOf(a)
 
-	// At this point both a and b are non-nil and non-zero
+	// At this point both a and b are non-nil and, unless merging with MergePresent, non-zero
 	kindA := valueA.Kind()
 	kindB := valueB.Kind()
 
 	// Special case: both values are pointers
 	if kindA == reflect.Ptr && kindA == kindB {
-		return mergePointers(valueA, valueB)
+		return mergePointers(valueA, valueB, strategy)
 	}
 
 	// Check if both kinds are supported for merging
@@ -93,12 +118,12 @@ func MergeValues(a, b interface{}) (interface{}, error) {
 	// Special case: both are maps
 	if kindA == reflect.Map && kindA == kindB {
 		// Special case: maps need merging
-		return mergeMaps(valueA, valueB)
+		return mergeMaps(valueA, valueB, strategy)
 	}
 
 	// Special case: both are slices or arrays
 	if kindA == kindB && (kindA == reflect.Slice || kindA == reflect.Array) {
-		return mergeSlices(valueA, valueB)
+		return mergeSlices(valueA, valueB, strategy)
 	}
 
 	// Finally: try merging scalar values
@@ -106,8 +131,8 @@ func MergeValues(a, b interface{}) (interface{}, error) {
 }
 
 // mergePointers handles merging of pointer values
-func mergePointers(a reflect.Value, b reflect.Value) (interface{}, error) {
-	merged, err := MergeValues(a.Elem().Interface(), b.Elem().Interface())
+func mergePointers(a reflect.Value, b reflect.Value, strategy MergeStrategy) (interface{}, error) {
+	merged, err := mergeValues(a.Elem().Interface(), b.Elem().Interface(), strategy)
 	if err != nil {
 		return nil, err
 	} else if merged == nil {
@@ -121,7 +146,7 @@ func mergePointers(a reflect.Value, b reflect.Value) (interface{}, error) {
 }
 
 // mergeMaps handles merging of map values
-func mergeMaps(a reflect.Value, b reflect.Value) (m interface{}, err error) {
+func mergeMaps(a reflect.Value, b reflect.Value, strategy MergeStrategy) (m interface{}, err error) {
 	mValue := reflect.MakeMap(a.Type())
 	var sampleKeyValue reflect.Value
 
@@ -134,13 +159,12 @@ func mergeMaps(a reflect.Value, b reflect.Value) (m interface{}, err error) {
 	// Now iterate over all keys from b and set them on our result map
 	for _, k := range b.MapKeys() {
 		// Convert key
-		convertedKeyIntf, convertErr := convertScalarValues(sampleKeyValue, k)
+		key, convertErr := convertMapKey(a.Type().Key(), sampleKeyValue, k)
 		if convertErr != nil {
 			err = multierror.Append(err, multierror.Prefix(convertErr, fmt.Sprintf("key %v:", k.Interface())))
 			continue
 		}
-
-		key := reflect.ValueOf(convertedKeyIntf)
+		convertedKeyIntf := key.Interface()
 		v := b.MapIndex(k)
 
 		// Check if key exists
@@ -153,7 +177,7 @@ func mergeMaps(a reflect.Value, b reflect.Value) (m interface{}, err error) {
 
 		// The key does already exist, in which case we need to merge the existing value and the
 		// value from b
-		mergedV, mergeErr := MergeValues(existingV.Interface(), v.Interface())
+		mergedV, mergeErr := mergeValues(existingV.Interface(), v.Interface(), strategy)
 		if mergeErr != nil {
 			err = multierror.Append(err, multierror.Prefix(mergeErr, fmt.Sprintf("key %v:", convertedKeyIntf)))
 			continue
@@ -168,11 +192,32 @@ func mergeMaps(a reflect.Value, b reflect.Value) (m interface{}, err error) {
 	return
 }
 
+// convertMapKey converts the key k so it can be used on a map with the given key type.
+//
+// If sample is valid, it is used for determining the target type, which allows map[interface{}]interface{}
+// keys to be converted to the type of the keys already present.
+func convertMapKey(keyType reflect.Type, sample reflect.Value, k reflect.Value) (reflect.Value, error) {
+	if sample.IsValid() {
+		converted, err := convertScalarValues(sample, k)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(converted), nil
+	}
+
+	// The map does not contain any keys yet, so convert to the map's key type directly
+	if !k.Type().ConvertibleTo(keyType) {
+		return reflect.Value{}, fmt.Errorf("Kind mismatch: %s != %s", keyType.Kind(), k.Type().Kind())
+	}
+	return k.Convert(keyType), nil
+}
+
 // mergeSlices merges two slices
 //
-// The logic is very simple: if b is not empty return b, otherwise, return a
-func mergeSlices(a reflect.Value, b reflect.Value) (interface{}, error) {
-	if b.Len() != 0 {
+// The logic is very simple: if b is not empty return b, otherwise, return a.
+// With MergePresent, b is returned even if it is empty.
+func mergeSlices(a reflect.Value, b reflect.Value, strategy MergeStrategy) (interface{}, error) {
+	if strategy == MergePresent || b.Len() != 0 {
 		return b.Interface(), nil
 	}
 
@@ -200,3 +245,17 @@ func convertScalarValues(a reflect.Value, b reflect.Value) (interface{}, error)
 
 	return nil, fmt.Errorf("Kind mismatch: %s != %s", aType.Kind(), bType.Kind())
 }
+
+// removeNilValues recursively removes all keys holding nil values from a map representation
+// of a configuration
+func removeNilValues(m interface{}) {
+	mv := reflect.ValueOf(m)
+	for _, k := range mv.MapKeys() {
+		v := mv.MapIndex(k).Interface()
+		if v == nil {
+			mv.SetMapIndex(k, reflect.Value{})
+		} else if reflect.ValueOf(v).Kind() == reflect.Map {
+			removeNilValues(v)
+		}
+	}
+}
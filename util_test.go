@@ -213,6 +213,25 @@ func TestMergeMapsMapStringInterfaceMapInterfaceInterface(t *testing.T) {
 	})
 }
 
+func TestMergeMapsEmptyMapInterfaceInterface(t *testing.T) {
+	a := map[string]interface{}{
+		"servers": map[interface{}]interface{}{},
+	}
+	b := map[string]interface{}{
+		"servers": map[string]interface{}{
+			"a": "a.example.com",
+		},
+	}
+
+	result, err := structconf.MergeMaps(a, b)
+	require.NoError(t, err)
+	require.EqualValues(t, map[string]interface{}{
+		"servers": map[interface{}]interface{}{
+			"a": "a.example.com",
+		},
+	}, result)
+}
+
 func TestMergeLoggingConfigWithMapStringString(t *testing.T) {
 	a := map[string]interface{}{
 		"a:": map[string]interface{}{
@@ -459,3 +478,50 @@ func TestMergeValues_ConvertibleCustomStringType(t *testing.T) {
 	require.IsType(t, testString(""), merged)
 	require.EqualValues(t, b, merged)
 }
+
+func TestMergeMapsWithStrategy_Present(t *testing.T) {
+	one := 1
+	zero := 0
+
+	a := map[string]interface{}{
+		"enabled": true,
+		"retries": 3,
+		"name":    "default",
+		"tags":    []interface{}{"a"},
+		"ptr":     &one,
+		"nested": map[string]interface{}{
+			"enabled": true,
+			"kept":    "kept",
+		},
+	}
+	b := map[string]interface{}{
+		"enabled": false,
+		"retries": 0.0,
+		"name":    nil,
+		"tags":    []interface{}{},
+		"ptr":     &zero,
+		"nested": map[string]interface{}{
+			"enabled": false,
+		},
+	}
+
+	result, err := structconf.MergeMapsWithStrategy(a, b, structconf.MergePresent)
+	require.NoError(t, err)
+	require.EqualValues(t, map[string]interface{}{
+		"enabled": false,
+		"retries": 0,
+		// nil values are treated as not set
+		"name": "default",
+		"tags": []interface{}{},
+		"ptr":  &zero,
+		"nested": map[string]interface{}{
+			"enabled": false,
+			"kept":    "kept",
+		},
+	}, result)
+
+	// The same maps merged using MergeNonZero keep all values of a
+	result, err = structconf.MergeMapsWithStrategy(a, b, structconf.MergeNonZero)
+	require.NoError(t, err)
+	require.EqualValues(t, a, result)
+}
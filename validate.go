@@ -0,0 +1,226 @@
+package structconf
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// ValidationTagName defines the name of the struct tag holding validation rules.
+//
+// Rules are separated by commas, like `validate:"required,max=65535"`.
+// Supported rules are:
+//
+//   - required: the value must not be a zero-value or, for slices and maps, empty
+//   - omitempty: skips all further rules if the value is a zero-value
+//   - min=N, max=N: the value must be at least or at most N. For strings, slices, arrays and maps
+//     the length is checked. For time.Duration values N may be given as duration string, like "1s".
+//   - oneof=A B C: the value must be one of the space-separated values
+const ValidationTagName = "validate"
+
+// Validator defines the interface configuration structs may implement to validate
+// the configuration as a whole.
+//
+// Validate is called on a scratch copy of the configuration, which only holds the values
+// of fields handled by the mapper.
+type Validator interface {
+	// Validate returns an error if the configuration is invalid
+	Validate() error
+}
+
+var _ error = (*FieldError)(nil)
+
+// FieldError indicates that the value of a field violates a validation rule
+type FieldError struct {
+	// Path is the dotted key path of the field
+	Path string
+	// Rule is the violated rule, like "max=65535"
+	Rule string
+	// Message describes the violation
+	Message string
+}
+
+// Error returns the error string and causes FieldError to implement the error interface
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// validate validates a decoded instance of the configuration type using the validation tags of
+// its fields and, if implemented, its Validate method
+func (c *Configuration) validate(scratch reflect.Value) error {
+	err := c.validateStruct(scratch.Elem(), nil)
+
+	if validator, ok := scratch.Interface().(Validator); ok {
+		if validateErr := validator.Validate(); validateErr != nil {
+			err = multierror.Append(err, validateErr)
+		}
+	}
+
+	return err
+}
+
+// validateStruct validates the fields of the struct v and its nested structs
+func (c *Configuration) validateStruct(v reflect.Value, prefix []string) (err error) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		fieldD := t.Field(i)
+		fieldV := v.Field(i)
+
+		if fieldD.Anonymous {
+			// Fields of anonymous structs are treated as fields of the embedding struct
+			if embedded := reflect.Indirect(fieldV); embedded.Kind() == reflect.Struct {
+				if embeddedErr := c.validateStruct(embedded, prefix); embeddedErr != nil {
+					err = multierror.Append(err, embeddedErr)
+				}
+			}
+			continue
+		}
+
+		if !unicode.IsUpper([]rune(fieldD.Name)[0]) {
+			// Ignore private fields
+			continue
+		}
+
+		name := fieldName(fieldD, c.tagName)
+		if name == "-" {
+			continue
+		}
+
+		path := append(prefix[:len(prefix):len(prefix)], name)
+
+		if rules := fieldD.Tag.Get(ValidationTagName); rules != "" {
+			if fieldErr := validateField(strings.Join(path, PathSeparator), rules, fieldV); fieldErr != nil {
+				err = multierror.Append(err, fieldErr)
+			}
+		}
+
+		if nested := reflect.Indirect(fieldV); nested.Kind() == reflect.Struct && !isTextUnmarshaler(nested.Type()) {
+			if nestedErr := c.validateStruct(nested, path); nestedErr != nil {
+				err = multierror.Append(err, nestedErr)
+			}
+		}
+	}
+
+	return
+}
+
+// validateField checks the value of a field against a comma-separated list of rules.
+// Only the first violated rule is reported.
+func validateField(path, rules string, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		name, param := rule, ""
+		if idx := strings.Index(rule, "="); idx != -1 {
+			name, param = rule[:idx], rule[idx+1:]
+		}
+
+		var message string
+		switch name {
+		case "required":
+			if isEmptyValue(v) {
+				message = "value is required"
+			}
+		case "omitempty":
+			if isEmptyValue(v) {
+				return nil
+			}
+		case "min", "max":
+			message = validateBound(name, param, v)
+		case "oneof":
+			if !isOneOf(v, strings.Fields(param)) {
+				message = fmt.Sprintf("must be one of %s", strings.Join(strings.Fields(param), ", "))
+			}
+		default:
+			message = "unknown validation rule"
+		}
+
+		if message != "" {
+			return &FieldError{
+				Path:    path,
+				Rule:    rule,
+				Message: message,
+			}
+		}
+	}
+
+	return nil
+}
+
+// isEmptyValue checks if v is a zero-value, a nil pointer or an empty slice or map
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// validateBound checks the min and max rules and returns a message if the rule is violated
+func validateBound(name, param string, v reflect.Value) string {
+	var actual float64
+	var bound float64
+	var err error
+
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		actual = float64(v.Len())
+		bound, err = strconv.ParseFloat(param, 64)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		actual = float64(v.Int())
+		if v.Type() == durationType {
+			var d time.Duration
+			d, err = time.ParseDuration(param)
+			bound = float64(d)
+		} else {
+			bound, err = strconv.ParseFloat(param, 64)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		actual = float64(v.Uint())
+		bound, err = strconv.ParseFloat(param, 64)
+	case reflect.Float32, reflect.Float64:
+		actual = v.Float()
+		bound, err = strconv.ParseFloat(param, 64)
+	case reflect.Ptr:
+		// nil pointers are handled by the required rule
+		return ""
+	default:
+		return fmt.Sprintf("rule not applicable to %s values", v.Kind())
+	}
+
+	if err != nil {
+		return fmt.Sprintf("invalid rule parameter: %s", err.Error())
+	}
+
+	switch {
+	case name == "min" && actual < bound:
+		return fmt.Sprintf("must be at least %s", param)
+	case name == "max" && actual > bound:
+		return fmt.Sprintf("must be at most %s", param)
+	}
+	return ""
+}
+
+// isOneOf checks if the formatted value of v is one of the passed options
+func isOneOf(v reflect.Value, options []string) bool {
+	if v.Kind() == reflect.Ptr {
+		// nil pointers are handled by the required rule
+		return true
+	}
+
+	formatted := fmt.Sprint(v.Interface())
+	for _, option := range options {
+		if formatted == option {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package structconf
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/stretchr/testify/require"
+)
+
+type TestConfigValidateServer struct {
+	Host string `config:"host" validate:"required"`
+	Port int    `config:"port" validate:"min=1,max=65535"`
+}
+
+type TestConfigValidate struct {
+	Server   TestConfigValidateServer  `config:"server"`
+	Backup   *TestConfigValidateServer `config:"backup"`
+	LogLevel string                    `config:"log_level" validate:"oneof=debug info warn"`
+	Timeout  time.Duration             `config:"timeout" validate:"min=1s"`
+	Tags     []string                  `config:"tags" validate:"omitempty,min=2"`
+	Name     string                    `config:"name" validate:"required,max=5"`
+}
+
+var errTestValidate = errors.New("timeout must be below 1m when in debug mode")
+
+func (c *TestConfigValidate) Validate() error {
+	if c.LogLevel == "debug" && c.Timeout >= time.Minute {
+		return errTestValidate
+	}
+	return nil
+}
+
+func fieldErrorPaths(t *testing.T, err error) []string {
+	multiErr, ok := err.(*multierror.Error)
+	require.True(t, ok, "Returned error is not a multierror.Error")
+
+	var paths []string
+	for _, wrapped := range multiErr.WrappedErrors() {
+		fieldErr, ok := wrapped.(*FieldError)
+		require.True(t, ok, "Wrapped error %v is not a *FieldError", wrapped)
+		paths = append(paths, fieldErr.Path)
+	}
+	return paths
+}
+
+func TestFieldError_Error(t *testing.T) {
+	err := &FieldError{Path: "server.port", Rule: "max=65535", Message: "must be at most 65535"}
+	require.EqualError(t, err, "server.port: must be at most 65535")
+}
+
+func TestConfiguration_Load_Validate(t *testing.T) {
+	conf := &TestConfigValidate{}
+	// Incomplete defaults are not validated
+	c := newEnvTestConfiguration(t, conf,
+		`{"server":{"port":70000},"backup":{"host":"backup","port":0},"log_level":"trace","tags":["a"]}`,
+		OptionDefaults(&TestConfigValidate{Timeout: time.Second}))
+
+	before := *conf
+
+	err := c.Load()
+	require.Error(t, err)
+	require.EqualValues(t, []string{
+		"server.host",
+		"server.port",
+		"backup.port",
+		"log_level",
+		"tags",
+		"name",
+	}, fieldErrorPaths(t, err))
+
+	// The configuration has not been touched
+	require.EqualValues(t, before, *conf)
+}
+
+func TestConfiguration_Load_ValidateValid(t *testing.T) {
+	conf := &TestConfigValidate{}
+	c := newEnvTestConfiguration(t, conf,
+		`{"server":{"host":"localhost","port":8080},"log_level":"info","name":"test"}`,
+		OptionDefaults(&TestConfigValidate{Timeout: time.Second}))
+
+	require.NoError(t, c.Load())
+	require.EqualValues(t, "localhost", conf.Server.Host)
+}
+
+func TestConfiguration_Load_ValidateMethod(t *testing.T) {
+	conf := &TestConfigValidate{}
+	c := newEnvTestConfiguration(t, conf,
+		`{"server":{"host":"localhost","port":8080},"log_level":"debug","name":"test"}`,
+		OptionDefaults(&TestConfigValidate{Timeout: time.Hour}))
+
+	err := c.Load()
+	require.Error(t, err)
+	require.ErrorIs(t, err, errTestValidate)
+	require.EqualValues(t, "", conf.Server.Host)
+}
+
+func TestConfiguration_SetDefaults_Validate(t *testing.T) {
+	conf := &TestConfigValidate{}
+	c, err := NewConfiguration(conf)
+	require.NoError(t, err)
+
+	err = c.SetDefaults(&TestConfigValidate{
+		Server:   TestConfigValidateServer{Host: "localhost", Port: 80},
+		LogLevel: "info",
+		Timeout:  time.Second,
+		Name:     "too long",
+	})
+	require.Error(t, err)
+	require.EqualValues(t, []string{"name"}, fieldErrorPaths(t, err))
+	require.Empty(t, conf.Name)
+}
+
+func TestValidateField_UnknownRule(t *testing.T) {
+	type config struct {
+		Value string `config:"value" validate:"email"`
+		Flag  bool   `config:"flag" validate:"min=1"`
+		Count int    `config:"count" validate:"max=ten"`
+	}
+
+	c, err := NewConfiguration(&config{})
+	require.NoError(t, err)
+
+	err = c.validate(reflect.ValueOf(&config{}))
+	require.Error(t, err)
+
+	multiErr := err.(*multierror.Error)
+	require.Len(t, multiErr.WrappedErrors(), 3)
+	require.EqualError(t, multiErr.WrappedErrors()[0], "value: unknown validation rule")
+	require.EqualError(t, multiErr.WrappedErrors()[1], "flag: rule not applicable to bool values")
+	require.Contains(t, multiErr.WrappedErrors()[2].Error(), "count: invalid rule parameter")
+}
@@ -0,0 +1,64 @@
+package structconf
+
+import (
+	"errors"
+
+	"github.com/anexia-it/go-structconf/storage"
+)
+
+// SaveOption defines the function type of save options
+type SaveOption func(*saveOptions)
+
+// saveOptions holds the options passed to Save
+type saveOptions struct {
+	force bool
+}
+
+// SaveForce makes Save write the configuration, even if the stored configuration has been changed
+// since it was loaded
+func SaveForce() SaveOption {
+	return func(o *saveOptions) {
+		o.force = true
+	}
+}
+
+// setVersions replaces the recorded versions of the loaded configurations
+func (c *Configuration) setVersions(versions map[string]storage.Version) {
+	c.versionsMutex.Lock()
+	defer c.versionsMutex.Unlock()
+
+	c.versions = versions
+}
+
+// writeVersioned writes the encoded configuration to the versioned storage of the target source.
+//
+// Unless force is set, the write is conditional on the version recorded when the configuration
+// was loaded. If the configuration has not been loaded from the source yet, it is written
+// unconditionally.
+func (c *Configuration) writeVersioned(target *source, versioned storage.Versioned, encoded []byte, force bool) error {
+	// Saves are serialized, so consecutive saves expect the version written by their predecessor
+	c.versionsMutex.Lock()
+	defer c.versionsMutex.Unlock()
+
+	expected, ok := c.versions[target.name]
+	if !ok || force {
+		expected = storage.AnyVersion
+	}
+
+	version, err := versioned.WriteConfigVersion(encoded, expected)
+	if errors.Is(err, storage.ErrVersionNotSupported) {
+		// Storages wrapping storages without support for versions
+		version, err = storage.AnyVersion, target.storage.WriteConfig(encoded)
+	}
+	if version != storage.NoVersion {
+		// Partially failed writes still changed the stored configuration
+		if c.versions == nil {
+			c.versions = make(map[string]storage.Version)
+		}
+		c.versions[target.name] = version
+	}
+	if err != nil {
+		return sourceError(target, err)
+	}
+	return nil
+}
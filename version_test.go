@@ -0,0 +1,133 @@
+package structconf
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/anexia-it/go-structconf/storage"
+	"github.com/anexia-it/go-structconf/storage/aferofile"
+	"github.com/anexia-it/go-structconf/storage/backup"
+	"github.com/anexia-it/go-structconf/storage/memory"
+	"github.com/anexia-it/go-structconf/storage/tee"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfiguration_Save_Conflict(t *testing.T) {
+	enc := newTestEncodings(t)
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/config.json", []byte(`{"name":"initial"}`), 0640))
+
+	conf := &TestConfigEnv{}
+	c, err := NewConfiguration(conf,
+		OptionStorage(aferofile.NewAferoFileStorage(fs, "/config.json", 0640)),
+		OptionEncoding(enc.json))
+	require.NoError(t, err)
+	require.NoError(t, c.Load())
+
+	// Consecutive saves do not conflict with each other
+	conf.Name = "first"
+	require.NoError(t, c.Save())
+	conf.Name = "second"
+	require.NoError(t, c.Save())
+
+	// Changes made by others are not overwritten
+	require.NoError(t, afero.WriteFile(fs, "/config.json", []byte(`{"name":"other"}`), 0640))
+	conf.Name = "third"
+	require.ErrorIs(t, c.Save(), ErrConflict)
+
+	inBytes, err := afero.ReadFile(fs, "/config.json")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"name":"other"}`, string(inBytes))
+
+	// Unless saving is forced
+	require.NoError(t, c.Save(SaveForce()))
+	require.NoError(t, c.Save())
+
+	// Loading again picks up the current version
+	require.NoError(t, afero.WriteFile(fs, "/config.json", []byte(`{"name":"other"}`), 0640))
+	require.NoError(t, c.Load())
+	conf.Name = "fourth"
+	require.NoError(t, c.Save())
+}
+
+func TestConfiguration_Save_ConflictSources(t *testing.T) {
+	enc := newTestEncodings(t)
+	fs := afero.NewMemMapFs()
+
+	c, err := NewConfiguration(&TestConfigEnv{},
+		OptionSource("user", aferofile.NewAferoFileStorage(fs, "/user.yaml", 0640), enc.yaml, 10,
+			SourceOptional(), SourceWritable()))
+	require.NoError(t, err)
+
+	// Configurations which have not been loaded are written unconditionally
+	require.NoError(t, c.Save())
+	require.NoError(t, fs.Remove("/user.yaml"))
+
+	// A missing configuration must still be missing when saving
+	require.NoError(t, c.Load())
+	require.NoError(t, afero.WriteFile(fs, "/user.yaml", []byte("name: other\n"), 0640))
+	err = c.Save()
+	require.ErrorIs(t, err, ErrConflict)
+	require.EqualError(t, err, "source user: "+ErrConflict.Error())
+}
+
+// plainStorage hides all optional interfaces of the wrapped storage
+type plainStorage struct {
+	storage.Storage
+}
+
+func TestConfiguration_VersionNotSupported(t *testing.T) {
+	enc := newTestEncodings(t)
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/config.json", []byte(`{"name":"initial"}`), 0640))
+
+	// The backup storage wraps a storage which supports neither versions nor watching
+	conf := &TestConfigEnv{}
+	c, err := NewConfiguration(conf,
+		OptionStorage(backup.NewBackupStorage(plainStorage{aferofile.NewAferoFileStorage(fs, "/config.json", 0640)},
+			backup.AferoFileSlots(fs, "/config.json", 0640))),
+		OptionEncoding(enc.json))
+	require.NoError(t, err)
+	require.NoError(t, c.Load())
+	require.EqualValues(t, "initial", conf.Name)
+
+	// Saving does not depend on the stored version
+	require.NoError(t, afero.WriteFile(fs, "/config.json", []byte(`{"name":"other"}`), 0640))
+	conf.Name = "saved"
+	require.NoError(t, c.Save())
+
+	inBytes, err := afero.ReadFile(fs, "/config.json.1")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"name":"other"}`, string(inBytes))
+
+	require.ErrorIs(t, c.Watch(context.Background()), storage.ErrWatchNotSupported)
+}
+
+func TestConfiguration_Save_PartialWrite(t *testing.T) {
+	enc := newTestEncodings(t)
+	primary := memory.NewMemoryStorage(memory.OptionData([]byte(`{"name":"initial"}`)))
+	secondary := memory.NewMemoryStorage()
+
+	conf := &TestConfigEnv{}
+	c, err := NewConfiguration(conf,
+		OptionStorage(tee.NewTeeStorage([]storage.Storage{primary, secondary})),
+		OptionEncoding(enc.json))
+	require.NoError(t, err)
+	require.NoError(t, c.Load())
+
+	// The primary storage was written, so its new version is expected by the next save
+	testErr := errors.New("test error")
+	secondary.FailNextWrite(testErr)
+	conf.Name = "partial"
+	require.ErrorIs(t, c.Save(), testErr)
+
+	conf.Name = "saved"
+	require.NoError(t, c.Save())
+
+	written, _ := primary.Data()
+	mirrored, _ := secondary.Data()
+	require.Contains(t, string(written), `"name":"saved"`)
+	require.EqualValues(t, string(written), string(mirrored))
+}